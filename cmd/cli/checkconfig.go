@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newCheckConfigCmd() *cobra.Command {
+	var (
+		workspaceFolder string
+		format          string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check-config",
+		Short: "Check the devcontainer.json files of a workspace against the devcontainer.json schema",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			issues, err := devctmpl.CheckConfigs(workspaceFolder)
+			if err != nil {
+				return fmt.Errorf("failed to check configuration: %w", err)
+			}
+
+			if err := devctmpl.WriteReport(cmd.OutOrStdout(), devctmpl.ReportFormat(format), devctmpl.ConfigRules, issues); err != nil {
+				return err
+			}
+
+			if devctmpl.HasErrors(issues) {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("workspace %s has an invalid devcontainer.json", workspaceFolder)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&workspaceFolder, "workspace-folder", "w", "", "Workspace folder containing the devcontainer.json")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json, sarif)")
+	cmd.MarkFlagRequired("workspace-folder")
+	return cmd
+}
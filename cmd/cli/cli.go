@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/mazurov/devcontainer-template/internal/logger"
 	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
@@ -20,6 +24,22 @@ func main() {
 		tmpDir          string
 		keepTmpDir      bool
 		omitPaths       string
+		configName      string
+		layout          string
+		asConfig        string
+		targetSubdir    string
+		output          string
+		outputFormat    string
+		dryRun          bool
+		showDiff        bool
+		format          string
+		onConflict      string
+		strict          bool
+		features        string
+		checkFeatures   bool
+		lock            bool
+		checkImages     bool
+		lint            bool
 	)
 
 	cmd := &cobra.Command{
@@ -34,11 +54,26 @@ func main() {
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log := logger.GetLogger()
+			if workspaceFolder == "" && output == "" {
+				return fmt.Errorf("either --workspace-folder or --output must be set")
+			}
+			if output != "" {
+				// These flags only apply to a workspace folder
+				for _, name := range []string{"dry-run", "diff", "on-conflict", "format"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s can't be used with --output", name)
+					}
+				}
+				if lint && workspaceFolder == "" {
+					return fmt.Errorf("--lint with --output requires --workspace-folder to load the project lint configuration")
+				}
+			}
 			// Parse template arguments
 			options := make(map[string]string)
 			if templateArgs != "" {
 				log.Debug("Parsing template arguments")
-				if err := json.Unmarshal([]byte(templateArgs), &options); err != nil {
+				var err error
+				if options, err = parseTemplateArgs(templateArgs); err != nil {
 					return fmt.Errorf("invalid template arguments JSON: %w", err)
 				}
 			}
@@ -51,6 +86,14 @@ func main() {
 				}
 			}
 
+			var featureList []devctmpl.Feature
+			if features != "" {
+				log.Debug("Parsing features")
+				if err := json.Unmarshal([]byte(features), &featureList); err != nil {
+					return fmt.Errorf("invalid features JSON: %w", err)
+				}
+			}
+
 			log.WithFields(logrus.Fields{
 				"templateID": templateID,
 				"workspace":  workspaceFolder,
@@ -62,7 +105,50 @@ func main() {
 			config.TmpRootDir = tmpDir
 			config.KeepTmpDir = keepTmpDir
 			config.OmitPaths = omitPathsArray
-			if err := devctmpl.GenerateTemplateWithConfig(templateID, workspaceFolder, options, config); err != nil {
+			config.ConfigName = configName
+			config.Layout = devctmpl.Layout(layout)
+			config.AsConfig = asConfig
+			config.TargetSubdir = targetSubdir
+			config.Features = featureList
+			config.CheckFeatures = checkFeatures
+			config.CheckImages = checkImages
+			config.Lock = lock
+			config.Strict = strict
+			if lint {
+				lintConfig, err := devctmpl.LoadLintConfig(workspaceFolder)
+				if err != nil {
+					return fmt.Errorf("failed to load lint configuration: %w", err)
+				}
+				config.Lint = lintConfig
+			}
+			config.OnIssue = func(issue devctmpl.Issue) { log.Warn(issue) }
+			config.OnConflict = devctmpl.ConflictPolicy(onConflict)
+			config.Prompt = newConflictPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())
+
+			if output != "" {
+				if err := writeOutput(cmd, output, devctmpl.OutputFormat(outputFormat), templateID, options, config); err != nil {
+					return fmt.Errorf("failed to generate template: %w", err)
+				}
+				log.Info("Template generated successfully")
+				return nil
+			}
+
+			if dryRun {
+				plan, err := devctmpl.PlanTemplate(templateID, workspaceFolder, options, config)
+				if err != nil {
+					return fmt.Errorf("failed to plan template: %w", err)
+				}
+				if err := devctmpl.WritePlan(cmd.OutOrStdout(), devctmpl.ReportFormat(format), plan, showDiff); err != nil {
+					return err
+				}
+				if n := plan.Count(devctmpl.ActionConflict); n > 0 {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("%d files already exist in target directory and differ from the template (choose a conflict policy to apply anyway)", n)
+				}
+				return nil
+			}
+
+			if err := devctmpl.GenerateTemplateWithContext(cmd.Context(), templateID, workspaceFolder, options, config); err != nil {
 				return fmt.Errorf("failed to generate template: %w", err)
 			}
 
@@ -73,19 +159,76 @@ func main() {
 
 	// Add flags
 	cmd.Flags().StringVarP(&workspaceFolder, "workspace-folder", "w", "", "Target workspace folder")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the rendered template to a directory or a .tar, .tar.gz or .zip archive instead of the workspace folder, '-' for stdout")
+	cmd.Flags().StringVarP(&outputFormat, "output-format", "", "", "Format of --output (dir, tar, tar.gz, zip), by default derived from its extension, tar for stdout")
 	cmd.Flags().StringVarP(&templateID, "template-id", "t", "", "Source template directory")
 	cmd.Flags().StringVarP(&templateArgs, "template-args", "a", "", "Template arguments as JSON string")
 	cmd.Flags().StringVarP(&tmpDir, "tmp-dir", "", "", "Directory to use for temporary files. If not provided, the system default will be used.")
 	cmd.Flags().BoolVarP(&keepTmpDir, "keep-tmp-dir", "", false, "Keep temporary directory after execution")
-	cmd.Flags().StringVarP(&omitPaths, "omit-paths", "", "", "List of paths within the Template to omit applying, provided as JSON.  To ignore a directory append '/*'")
+	cmd.Flags().StringVarP(&omitPaths, "omit-paths", "", "", "List of optional paths within the Template to omit applying, provided as JSON. Glob patterns such as 'dir/*' and '**/*.md' are supported")
+
+	cmd.Flags().StringVarP(&configName, "config-name", "", "", "Apply only the named sub-configuration .devcontainer/<name>/devcontainer.json")
+	cmd.Flags().StringVarP(&layout, "layout", "", "", "Convert the configuration to the 'root' (.devcontainer.json) or 'folder' (.devcontainer/devcontainer.json) layout")
+
+	cmd.Flags().StringVarP(&targetSubdir, "target-subdir", "", "", "Write the template to a relative path inside the workspace folder, e.g. 'services/api'")
+	cmd.Flags().StringVarP(&asConfig, "as-config", "", "", "Apply the template as the named sub-configuration .devcontainer/<name>/, next to the existing configurations")
+
+	cmd.Flags().StringVarP(&features, "features", "", "", `Features to add to the generated devcontainer.json, provided as JSON, e.g. '[{"id": "ghcr.io/devcontainers/features/go:1", "options": {"version": "1.22"}}]'`)
+	cmd.Flags().BoolVarP(&checkFeatures, "check-features", "", false, "Fail if a feature of the generated devcontainer.json does not exist or gets options it does not define")
+	cmd.Flags().BoolVarP(&checkImages, "check-images", "", false, "Fail if an image of the generated devcontainer.json or its Dockerfiles is not published in its registry")
+	cmd.Flags().BoolVarP(&lock, "lock", "", false, "Write a devcontainer-lock.json pinning the features of the generated configuration by digest")
+	cmd.Flags().BoolVarP(&strict, "strict", "", false, "Fail if a generated devcontainer.json is not well-formed JSONC, has duplicate keys or doesn't match the devcontainer.json schema")
+	cmd.Flags().BoolVarP(&lint, "lint", "", false, "Run the lint rules on the generated devcontainer.json, failing on rules with error severity")
+	cmd.Flags().StringVarP(&onConflict, "on-conflict", "", string(devctmpl.ConflictFail), "What to do with existing files that differ from the template (fail, skip, overwrite, backup, prompt)")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "Print the changes applying the template would make without touching the workspace folder")
+	cmd.Flags().BoolVarP(&showDiff, "diff", "", false, "Include unified diffs of modified files in the dry-run plan")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Dry-run plan format (text, json)")
+
+	cmd.AddCommand(newSchemaCmd())
+	cmd.AddCommand(newValidateCmd())
+	cmd.AddCommand(newUpgradeCmd())
+	cmd.AddCommand(newRevertCmd())
+	cmd.AddCommand(newFeatureCmd())
+	cmd.AddCommand(newLockCmd())
+	cmd.AddCommand(newCheckConfigCmd())
+	cmd.AddCommand(newLintCmd())
 
 	cmd.PersistentFlags().StringVarP(&logLevel, "log-level", "l", "info", "Log level (debug, info, warn, error)")
 	// Mark required flags
-	cmd.MarkFlagRequired("workspace-folder")
 	cmd.MarkFlagRequired("template-id")
 
-	if err := cmd.Execute(); err != nil {
+	// Interrupting an apply rolls back the changes made so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.ExecuteContext(ctx); err != nil {
 		logger.GetLogger().Error(err)
+		stop()
 		os.Exit(1)
 	}
 }
+
+// parseTemplateArgs parses a JSON object of template arguments. Values may be
+// given as strings or as JSON booleans and numbers, which are converted to
+// their string form.
+func parseTemplateArgs(data string) (map[string]string, error) {
+	raw := make(map[string]any)
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, err
+	}
+
+	options := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			options[name] = v
+		case bool:
+			options[name] = strconv.FormatBool(v)
+		case float64:
+			options[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("option '%s' must be a string, boolean or number", name)
+		}
+	}
+	return options, nil
+}
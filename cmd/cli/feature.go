@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newFeatureCmd() *cobra.Command {
+	var (
+		workspaceFolder string
+		configName      string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "feature",
+		Short: "List, add or remove features of a workspace's devcontainer.json",
+	}
+	cmd.PersistentFlags().StringVarP(&workspaceFolder, "workspace-folder", "w", "", "Workspace folder containing the devcontainer.json")
+	cmd.PersistentFlags().StringVarP(&configName, "config-name", "", "", "Edit the named sub-configuration .devcontainer/<name>/devcontainer.json")
+	cmd.MarkPersistentFlagRequired("workspace-folder")
+
+	cmd.AddCommand(newFeatureListCmd(&workspaceFolder, &configName))
+	cmd.AddCommand(newFeatureAddCmd(&workspaceFolder, &configName))
+	cmd.AddCommand(newFeatureRemoveCmd(&workspaceFolder, &configName))
+	cmd.AddCommand(newFeatureCheckCmd(&workspaceFolder))
+	return cmd
+}
+
+func newFeatureListCmd(workspaceFolder *string, configName *string) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the features used by the workspace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			features, err := devctmpl.ListFeatures(*workspaceFolder, *configName)
+			if err != nil {
+				return fmt.Errorf("failed to list features: %w", err)
+			}
+			return writeFeatures(cmd.OutOrStdout(), devctmpl.ReportFormat(format), features)
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json)")
+	return cmd
+}
+
+func writeFeatures(w io.Writer, format devctmpl.ReportFormat, features []devctmpl.Feature) error {
+	switch format {
+	case devctmpl.FormatText, "":
+		for _, feature := range features {
+			line := feature.ID
+			if len(feature.Options) > 0 {
+				options, err := json.Marshal(feature.Options)
+				if err != nil {
+					return err
+				}
+				line += " " + string(options)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case devctmpl.FormatJSON:
+		if features == nil {
+			features = []devctmpl.Feature{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(features)
+	default:
+		return fmt.Errorf("unsupported format '%s' (supported formats: text, json)", format)
+	}
+}
+
+func newFeatureAddCmd(workspaceFolder *string, configName *string) *cobra.Command {
+	var (
+		options        string
+		skipValidation bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add <feature-id>",
+		Short: "Add a feature, or merge the options of a feature already used",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			feature := devctmpl.Feature{ID: args[0]}
+			if options != "" {
+				if err := json.Unmarshal([]byte(options), &feature.Options); err != nil {
+					return fmt.Errorf("invalid feature options JSON: %w", err)
+				}
+			}
+			if err := devctmpl.AddFeature(*workspaceFolder, *configName, feature, !skipValidation); err != nil {
+				return fmt.Errorf("failed to add feature: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&options, "options", "o", "", `Feature options as JSON, e.g. '{"version": "1.22"}'`)
+	cmd.Flags().BoolVarP(&skipValidation, "skip-validation", "", false, "Don't check the options against the feature's devcontainer-feature.json")
+	return cmd
+}
+
+func newFeatureRemoveCmd(workspaceFolder *string, configName *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <feature-id>",
+		Short: "Remove a feature",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := devctmpl.RemoveFeature(*workspaceFolder, *configName, args[0]); err != nil {
+				return fmt.Errorf("failed to remove feature: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+func newFeatureCheckCmd(workspaceFolder *string) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check that the features of the workspace exist and accept their options",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			issues, err := devctmpl.CheckFeatures(*workspaceFolder, nil)
+			if err != nil {
+				return fmt.Errorf("failed to check features: %w", err)
+			}
+			if err := devctmpl.WriteReport(cmd.OutOrStdout(), devctmpl.ReportFormat(format), devctmpl.FeatureRules, issues); err != nil {
+				return err
+			}
+			if devctmpl.HasErrors(issues) {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("workspace %s uses invalid features", *workspaceFolder)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json, sarif)")
+	return cmd
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newLintCmd() *cobra.Command {
+	var (
+		workspaceFolder string
+		configFiles     []string
+		format          string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the devcontainer.json files of a workspace against the lint rules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := devctmpl.LoadLintConfig(workspaceFolder, configFiles...)
+			if err != nil {
+				return fmt.Errorf("failed to load lint configuration: %w", err)
+			}
+			issues, err := devctmpl.Lint(workspaceFolder, config)
+			if err != nil {
+				return fmt.Errorf("failed to lint workspace: %w", err)
+			}
+
+			if err := devctmpl.WriteReport(cmd.OutOrStdout(), devctmpl.ReportFormat(format), devctmpl.LintRules, issues); err != nil {
+				return err
+			}
+
+			if devctmpl.HasErrors(issues) {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("workspace %s violates lint rules", workspaceFolder)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&workspaceFolder, "workspace-folder", "w", "", "Workspace folder containing the devcontainer.json")
+	cmd.Flags().StringArrayVarP(&configFiles, "config", "c", nil, "Lint configuration file overriding the user and project configuration, may be repeated")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json, sarif)")
+	cmd.MarkFlagRequired("workspace-folder")
+	return cmd
+}
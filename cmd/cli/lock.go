@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newLockCmd() *cobra.Command {
+	var (
+		workspaceFolder string
+		configName      string
+		update          bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Write the devcontainer-lock.json pinning the features of a workspace by digest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lock, err := devctmpl.LockFeatures(workspaceFolder, configName, update, nil)
+			if err != nil {
+				return fmt.Errorf("failed to lock features: %w", err)
+			}
+			ids := make([]string, 0, len(lock.Features))
+			for id := range lock.Features {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				feature := lock.Features[id]
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s %s\n", id, feature.Version, feature.Integrity)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&workspaceFolder, "workspace-folder", "w", "", "Workspace folder containing the devcontainer.json")
+	cmd.Flags().StringVarP(&configName, "config-name", "", "", "Lock the named sub-configuration .devcontainer/<name>/devcontainer.json")
+	cmd.Flags().BoolVarP(&update, "update", "", false, "Resolve every feature again instead of keeping the locked versions")
+	cmd.MarkFlagRequired("workspace-folder")
+	return cmd
+}
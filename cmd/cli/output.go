@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+// writeOutput renders the template to output, a directory, an archive file
+// or stdout for "-". Archive files are written to a temporary file next to
+// output, which replaces output only once the archive is complete.
+func writeOutput(cmd *cobra.Command, output string, format devctmpl.OutputFormat, templateID string, options map[string]string, config devctmpl.Config) (err error) {
+	if format == "" {
+		format = devctmpl.OutputFormatFor(output)
+		if output == "-" {
+			format = devctmpl.OutputTar
+		}
+	}
+
+	switch {
+	case format == devctmpl.OutputDir:
+		if output == "-" {
+			return fmt.Errorf("output format '%s' can't be written to stdout", format)
+		}
+		return generateToOutput(cmd, devctmpl.NewDirOutput(output), templateID, options, config)
+	case output == "-":
+		out, err := devctmpl.NewArchiveOutput(format, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+		return generateToOutput(cmd, out, templateID, options, config)
+	}
+
+	// Reject unsupported formats before anything is written
+	if _, err := devctmpl.NewArchiveOutput(format, nil); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	out, err := devctmpl.NewArchiveOutput(format, f)
+	if err != nil {
+		return err
+	}
+	if err = generateToOutput(cmd, out, templateID, options, config); err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to set output file mode: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err = os.Rename(f.Name(), output); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// generateToOutput renders the template to out and completes it
+func generateToOutput(cmd *cobra.Command, out devctmpl.OutputTarget, templateID string, options map[string]string, config devctmpl.Config) error {
+	if err := devctmpl.GenerateTemplateToOutput(cmd.Context(), templateID, options, config, out); err != nil {
+		return err
+	}
+	return out.Close()
+}
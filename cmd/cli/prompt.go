@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+// newConflictPrompt returns a prompt asking on out and reading answers from in
+// what to do with each conflicting file
+func newConflictPrompt(in io.Reader, out io.Writer) devctmpl.ConflictPromptFunc {
+	reader := bufio.NewReader(in)
+	return func(file devctmpl.PlannedFile) (devctmpl.ConflictPolicy, error) {
+		for {
+			fmt.Fprintf(out, "%s already exists and differs from the template. [o]verwrite, [s]kip, [b]ackup, show [d]iff, [q]uit? ", file.Path)
+			answer, err := reader.ReadString('\n')
+			if err != nil && answer == "" {
+				return "", fmt.Errorf("no answer for '%s': %w", file.Path, err)
+			}
+
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "o", "overwrite":
+				return devctmpl.ConflictOverwrite, nil
+			case "s", "skip":
+				return devctmpl.ConflictSkip, nil
+			case "b", "backup":
+				return devctmpl.ConflictBackup, nil
+			case "d", "diff":
+				fmt.Fprint(out, file.Diff)
+			case "q", "quit":
+				return devctmpl.ConflictFail, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newRevertCmd() *cobra.Command {
+	var (
+		workspaceFolder string
+		force           bool
+		targetSubdir    string
+		asConfig        string
+		format          string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "revert",
+		Short: "Undo the changes applying a template made to a workspace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := devctmpl.NewConfig()
+			config.TargetSubdir = targetSubdir
+			config.AsConfig = asConfig
+			plan, err := devctmpl.RevertTemplateWithContext(cmd.Context(), workspaceFolder, force, config)
+			if errors.Is(err, devctmpl.ErrWorkspaceChanged) {
+				// Show what was changed since the template was applied
+				if err := devctmpl.WritePlan(cmd.OutOrStdout(), devctmpl.ReportFormat(format), plan, true); err != nil {
+					return err
+				}
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%w, use --force to revert anyway", err)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to revert template: %w", err)
+			}
+			return devctmpl.WritePlan(cmd.OutOrStdout(), devctmpl.ReportFormat(format), plan, false)
+		},
+	}
+
+	cmd.Flags().StringVarP(&workspaceFolder, "workspace-folder", "w", "", "Workspace folder the template was applied to")
+	cmd.Flags().BoolVarP(&force, "force", "", false, "Revert even if files were changed after the template was applied")
+	cmd.Flags().StringVarP(&targetSubdir, "target-subdir", "", "", "Revert the template applied to this subdirectory of the workspace folder")
+	cmd.Flags().StringVarP(&asConfig, "as-config", "", "", "Revert the template applied as this named sub-configuration")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json)")
+	cmd.MarkFlagRequired("workspace-folder")
+	return cmd
+}
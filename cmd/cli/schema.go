@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newSchemaCmd() *cobra.Command {
+	var tmpDir string
+
+	cmd := &cobra.Command{
+		Use:   "schema <source>",
+		Short: "Print the JSON Schema of a template's options",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config := devctmpl.NewConfig()
+			config.TmpRootDir = tmpDir
+
+			template, err := devctmpl.LoadTemplate(args[0], config)
+			if err != nil {
+				return fmt.Errorf("failed to load template: %w", err)
+			}
+
+			schema, err := json.MarshalIndent(devctmpl.OptionsSchema(template), "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode schema: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(schema))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&tmpDir, "tmp-dir", "", "", "Directory to use for temporary files. If not provided, the system default will be used.")
+	return cmd
+}
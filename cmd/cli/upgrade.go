@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newUpgradeCmd() *cobra.Command {
+	var (
+		workspaceFolder string
+		templateID      string
+		templateArgs    string
+		base            string
+		targetSubdir    string
+		asConfig        string
+		tmpDir          string
+		dryRun          bool
+		showDiff        bool
+		format          string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Merge a new version of the applied template into a workspace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := devctmpl.UpgradeOptions{
+				Source: templateID,
+				Base:   base,
+				DryRun: dryRun,
+			}
+			if templateArgs != "" {
+				var err error
+				if opts.Options, err = parseTemplateArgs(templateArgs); err != nil {
+					return fmt.Errorf("invalid template arguments JSON: %w", err)
+				}
+			}
+
+			config := devctmpl.NewConfig()
+			config.TmpRootDir = tmpDir
+			config.TargetSubdir = targetSubdir
+			config.AsConfig = asConfig
+
+			plan, err := devctmpl.UpgradeTemplateWithContext(cmd.Context(), workspaceFolder, opts, config)
+			if err != nil {
+				return fmt.Errorf("failed to upgrade template: %w", err)
+			}
+			if err := devctmpl.WritePlan(cmd.OutOrStdout(), devctmpl.ReportFormat(format), plan, showDiff); err != nil {
+				return err
+			}
+
+			if n := plan.Count(devctmpl.ActionConflict); n > 0 && !dryRun {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d files have conflicts that need to be resolved", n)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&workspaceFolder, "workspace-folder", "w", "", "Workspace folder the template was applied to")
+	cmd.Flags().StringVarP(&templateID, "template-id", "t", "", "New template version. If not provided, the recorded source is used")
+	cmd.Flags().StringVarP(&templateArgs, "template-args", "a", "", "Template arguments as JSON string, overriding the recorded ones")
+	cmd.Flags().StringVarP(&targetSubdir, "target-subdir", "", "", "Upgrade the template applied to this subdirectory of the workspace folder")
+	cmd.Flags().StringVarP(&asConfig, "as-config", "", "", "Upgrade the template applied as this named sub-configuration")
+	cmd.Flags().StringVarP(&base, "base", "", "", "Previously applied template version, if the recorded source no longer provides it")
+	cmd.Flags().StringVarP(&tmpDir, "tmp-dir", "", "", "Directory to use for temporary files. If not provided, the system default will be used.")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "Print the changes without touching the workspace folder")
+	cmd.Flags().BoolVarP(&showDiff, "diff", "", false, "Include unified diffs of changed files")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json)")
+	cmd.MarkFlagRequired("workspace-folder")
+	return cmd
+}
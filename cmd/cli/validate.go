@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+	"github.com/spf13/cobra"
+)
+
+func newValidateCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "validate <dir>",
+		Short: "Check a template directory against the template spec",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			issues, err := devctmpl.ValidateTemplate(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to validate template: %w", err)
+			}
+
+			if err := devctmpl.WriteReport(cmd.OutOrStdout(), devctmpl.ReportFormat(format), devctmpl.TemplateRules, issues); err != nil {
+				return err
+			}
+
+			if devctmpl.HasErrors(issues) {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("template %s is not valid", args[0])
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format (text, json, sarif)")
+	return cmd
+}
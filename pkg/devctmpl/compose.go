@@ -0,0 +1,254 @@
+package devctmpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+	"gopkg.in/yaml.v3"
+)
+
+// composeFiles returns the Docker Compose files of a devcontainer.json as
+// given, in order
+func composeFiles(doc *jsonc.Document) []string {
+	node, err := doc.Get("/dockerComposeFile")
+	if err != nil {
+		return nil
+	}
+	if node.Kind == jsonc.String {
+		return []string{node.String()}
+	}
+	var files []string
+	if node.Kind == jsonc.Array {
+		for _, element := range node.Elements {
+			if element.Value.Kind == jsonc.String {
+				files = append(files, element.Value.String())
+			}
+		}
+	}
+	return files
+}
+
+// relocateComposeFiles rewrites the relative paths of the Docker Compose
+// files of a configuration in configDir of dir, before the folder movedFrom
+// is moved to movedTo. Compose resolves relative paths against the folder of
+// the first file, so the files are only rewritten if that folder moves.
+func relocateComposeFiles(dir string, configDir string, files []string, movedFrom string, movedTo string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	first, ok := composeFilePath(configDir, files[0])
+	if !ok {
+		return nil
+	}
+	fromDir := path.Dir(first)
+	toDir, moved := movedPath(fromDir, movedFrom, movedTo)
+	if !moved {
+		return nil
+	}
+
+	for _, file := range files {
+		rel, ok := composeFilePath(configDir, file)
+		if !ok {
+			continue
+		}
+		name := filepath.Join(dir, filepath.FromSlash(rel))
+		content, err := os.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Not part of the template
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		content, err = rewriteComposePaths(content, fromDir, toDir, movedFrom, movedTo)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite paths of %s: %w", rel, err)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, content, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// composeFilePath resolves a compose file of a configuration in configDir,
+// unless it is absolute or uses variables
+func composeFilePath(configDir string, file string) (string, bool) {
+	if file == "" || strings.Contains(file, "$") || path.IsAbs(file) || filepath.IsAbs(file) {
+		return "", false
+	}
+	return path.Join(configDir, file), true
+}
+
+// movedPath returns where target ends up if movedFrom is moved to movedTo
+func movedPath(target string, movedFrom string, movedTo string) (string, bool) {
+	if target == movedFrom {
+		return movedTo, true
+	}
+	if rest, ok := strings.CutPrefix(target, movedFrom+"/"); ok {
+		return path.Join(movedTo, rest), true
+	}
+	return target, false
+}
+
+// composeEdit replaces the scalar node with value
+type composeEdit struct {
+	node  *yaml.Node
+	value string
+}
+
+// rewriteComposePaths rewrites the relative paths of a Docker Compose file
+// whose project folder moves from fromDir to toDir, like rewriteConfigPaths:
+// build contexts, bind mount sources, env files, extended files and the
+// files of secrets and configs. Values are replaced in place, so the
+// formatting and comments of the file are kept.
+func rewriteComposePaths(content []byte, fromDir string, toDir string, movedFrom string, movedTo string) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return content, nil
+	}
+	top := root.Content[0]
+
+	var edits []composeEdit
+	relocate := func(node *yaml.Node) {
+		if node == nil || node.Kind != yaml.ScalarNode || strings.ContainsAny(node.Value, "$~") {
+			return
+		}
+		if rel, ok := relocatePath(node.Value, fromDir, toDir, movedFrom, movedTo); ok {
+			edits = append(edits, composeEdit{node: node, value: rel})
+		}
+	}
+
+	for _, service := range yamlMappingValues(yamlMappingValue(top, "services")) {
+		build := yamlMappingValue(service, "build")
+		if build != nil && build.Kind == yaml.MappingNode {
+			build = yamlMappingValue(build, "context")
+		}
+		relocate(build)
+
+		if volumes := yamlMappingValue(service, "volumes"); volumes != nil && volumes.Kind == yaml.SequenceNode {
+			for _, volume := range volumes.Content {
+				switch volume.Kind {
+				case yaml.ScalarNode:
+					// Short syntax, SOURCE:TARGET[:MODE], relative sources
+					// start with a dot
+					source, rest, ok := strings.Cut(volume.Value, ":")
+					if !ok || !strings.HasPrefix(source, ".") {
+						continue
+					}
+					if rel, ok := relocatePath(source, fromDir, toDir, movedFrom, movedTo); ok {
+						edits = append(edits, composeEdit{node: volume, value: rel + ":" + rest})
+					}
+				case yaml.MappingNode:
+					if kind := yamlMappingValue(volume, "type"); kind != nil && kind.Value == "bind" {
+						relocate(yamlMappingValue(volume, "source"))
+					}
+				}
+			}
+		}
+
+		switch envFile := yamlMappingValue(service, "env_file"); {
+		case envFile == nil:
+		case envFile.Kind == yaml.SequenceNode:
+			for _, file := range envFile.Content {
+				if file.Kind == yaml.MappingNode {
+					file = yamlMappingValue(file, "path")
+				}
+				relocate(file)
+			}
+		default:
+			relocate(envFile)
+		}
+
+		if extends := yamlMappingValue(service, "extends"); extends != nil && extends.Kind == yaml.MappingNode {
+			relocate(yamlMappingValue(extends, "file"))
+		}
+	}
+	for _, section := range []string{"secrets", "configs"} {
+		for _, entry := range yamlMappingValues(yamlMappingValue(top, section)) {
+			relocate(yamlMappingValue(entry, "file"))
+		}
+	}
+
+	return applyComposeEdits(content, edits)
+}
+
+// yamlMappingValue returns the value of key in a mapping node, or nil
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlMappingValues returns the values of a mapping node
+func yamlMappingValues(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var values []*yaml.Node
+	for i := 1; i < len(node.Content); i += 2 {
+		values = append(values, node.Content[i])
+	}
+	return values
+}
+
+// applyComposeEdits replaces the edited scalars in content, keeping their
+// quoting style. Scalars that can't be located in the source, such as
+// multi-line or escaped strings, are reported as errors.
+func applyComposeEdits(content []byte, edits []composeEdit) ([]byte, error) {
+	sort.Slice(edits, func(i, j int) bool {
+		a, b := edits[i].node, edits[j].node
+		if a.Line != b.Line {
+			return a.Line > b.Line
+		}
+		return a.Column > b.Column
+	})
+
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	for _, edit := range edits {
+		node := edit.node
+		if node.Line < 1 || node.Line > len(lines) {
+			return nil, fmt.Errorf("can't locate '%s'", node.Value)
+		}
+		line := []rune(string(lines[node.Line-1]))
+		start := node.Column - 1
+
+		var old, replacement string
+		switch node.Style {
+		case 0:
+			old, replacement = node.Value, edit.value
+		case yaml.SingleQuotedStyle:
+			old = "'" + strings.ReplaceAll(node.Value, "'", "''") + "'"
+			replacement = "'" + strings.ReplaceAll(edit.value, "'", "''") + "'"
+		case yaml.DoubleQuotedStyle:
+			old, replacement = `"`+node.Value+`"`, `"`+edit.value+`"`
+		}
+		end := start + len([]rune(old))
+		if old == "" || start < 0 || end > len(line) || string(line[start:end]) != old {
+			return nil, fmt.Errorf("can't rewrite '%s' at line %d", node.Value, node.Line)
+		}
+		lines[node.Line-1] = []byte(string(line[:start]) + replacement + string(line[end:]))
+	}
+	return bytes.Join(lines, nil), nil
+}
@@ -0,0 +1,456 @@
+package devctmpl
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// ConfigRules are the checks run by CheckConfigs
+var ConfigRules = []Rule{
+	{ID: "config-syntax", Description: "devcontainer.json is well-formed JSONC without duplicate keys"},
+	{ID: "config-schema", Description: "devcontainer.json matches the devcontainer.json schema"},
+}
+
+// devContainerSchemaURL is the location the embedded schema is compiled
+// from, it is not fetched
+const devContainerSchemaURL = "https://containers.dev/schemas/devContainer.base.schema.json"
+
+// devContainerSchemaJSON is schemas/devContainer.base.schema.json of the
+// devcontainers/spec repository, which has no external references. `make
+// schema` downloads it at the commit DEVCONTAINER_SPEC_COMMIT of the Makefile.
+//
+//go:embed schemas/devContainer.base.schema.json
+var devContainerSchemaJSON []byte
+
+var (
+	devContainerSchemaOnce sync.Once
+	devContainerSchema     *jsonschema.Schema
+	devContainerSchemaErr  error
+)
+
+// compileDevContainerSchema compiles the bundled schema once
+func compileDevContainerSchema() (*jsonschema.Schema, error) {
+	devContainerSchemaOnce.Do(func() {
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(devContainerSchemaJSON))
+		if err != nil {
+			devContainerSchemaErr = fmt.Errorf("failed to parse devcontainer.json schema: %w", err)
+			return
+		}
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource(devContainerSchemaURL, doc); err != nil {
+			devContainerSchemaErr = fmt.Errorf("failed to load devcontainer.json schema: %w", err)
+			return
+		}
+		devContainerSchema, devContainerSchemaErr = compiler.Compile(devContainerSchemaURL)
+	})
+	return devContainerSchema, devContainerSchemaErr
+}
+
+// CheckConfigs checks that the devcontainer.json files in dir are
+// well-formed JSONC and match the devcontainer.json schema. Issues name the
+// JSON pointer of the offending value and its line. File paths in issues are
+// joined with dir.
+func CheckConfigs(dir string) ([]Issue, error) {
+	issues, err := checkConfigs(dir)
+	for i := range issues {
+		issues[i].File = filepath.Join(dir, filepath.FromSlash(issues[i].File))
+	}
+	return issues, err
+}
+
+// checkConfigs is CheckConfigs with file paths relative to dir
+func checkConfigs(dir string) ([]Issue, error) {
+	schema, err := compileDevContainerSchema()
+	if err != nil {
+		return nil, err
+	}
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	for _, config := range configs {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(config.Path)))
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, checkConfig(schema, config.Path, content)...)
+	}
+	return issues, nil
+}
+
+// checkConfig checks the content of a single devcontainer.json
+func checkConfig(schema *jsonschema.Schema, path string, content []byte) []Issue {
+	if err := jsonc.Validate(content); err != nil {
+		issue := Issue{Rule: "config-syntax", Severity: SeverityError, Message: err.Error(), File: path}
+		var syntaxErr *jsonc.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			issue.Line = syntaxErr.Line
+		}
+		return []Issue{issue}
+	}
+	doc, err := jsonc.Parse(content)
+	if err != nil {
+		return []Issue{{Rule: "config-syntax", Severity: SeverityError, Message: err.Error(), File: path}}
+	}
+	data, err := jsonc.ToJSON(content)
+	if err != nil {
+		return []Issue{{Rule: "config-syntax", Severity: SeverityError, Message: err.Error(), File: path}}
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return []Issue{{Rule: "config-syntax", Severity: SeverityError, Message: err.Error(), File: path}}
+	}
+
+	err = schema.Validate(instance)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil
+	}
+
+	r := &schemaReporter{
+		doc:      doc,
+		schemas:  indexSchemas(schema),
+		declared: make(map[*jsonschema.Schema]map[string]bool),
+		printer:  message.NewPrinter(language.English),
+	}
+	var issues []Issue
+	for _, problem := range r.problems(validationErr) {
+		line := 0
+		if node, err := doc.Get(problem.pointer); err == nil {
+			line, _ = doc.Position(node)
+		}
+		location := problem.pointer
+		if location == "" {
+			location = "/"
+		}
+		issues = append(issues, Issue{
+			Rule:     "config-schema",
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("%s: %s", location, problem.message()),
+			File:     path,
+			Line:     line,
+		})
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
+
+// schemaProblem is a problem found validating a configuration against the
+// schema
+type schemaProblem struct {
+	pointer string
+	msg     string
+	// required is set for missing properties, notAllowed for properties
+	// that are not allowed
+	required   bool
+	notAllowed bool
+	// missing and want hold the alternatives of a missing property and of
+	// an expected type, so failed alternatives are reported as one problem
+	missing []string
+	got     string
+	want    []string
+}
+
+func (p schemaProblem) message() string {
+	switch {
+	case len(p.missing) > 0:
+		return "missing property " + alternatives(p.missing, "'")
+	case len(p.want) > 0:
+		return fmt.Sprintf("got %s, want %s", p.got, alternatives(p.want, ""))
+	}
+	return p.msg
+}
+
+// alternatives formats values as "a, b or c", quoting each with quote
+func alternatives(values []string, quote string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = quote + value + quote
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// schemaReporter turns the validation errors of a configuration into the
+// problems to report. The devcontainer.json schema combines the image,
+// Dockerfile and Docker Compose configurations with oneOf, so when none
+// matches only the alternative the configuration was meant to be is
+// reported, instead of the failures of every alternative.
+type schemaReporter struct {
+	doc *jsonc.Document
+	// schemas maps the locations of the schema and its subschemas to them
+	schemas map[string]*jsonschema.Schema
+	// declared caches the properties declared by each subschema
+	declared map[*jsonschema.Schema]map[string]bool
+	printer  *message.Printer
+}
+
+func (r *schemaReporter) problems(err *jsonschema.ValidationError) []schemaProblem {
+	pointer := instancePointer(err.InstanceLocation)
+	switch k := err.ErrorKind.(type) {
+	case *kind.OneOf:
+		if k.Subschemas == nil && len(err.Causes) > 0 {
+			return r.closestAlternative(err)
+		}
+	case *kind.AnyOf:
+		if len(err.Causes) > 0 {
+			return r.closestAlternative(err)
+		}
+	case *kind.AdditionalProperties:
+		// Report every unknown property at its own line
+		var problems []schemaProblem
+		for _, property := range k.Properties {
+			problems = append(problems, schemaProblem{pointer: pointer + "/" + jsonc.EscapePointer(property), msg: "property is not allowed", notAllowed: true})
+		}
+		return problems
+	case *kind.FalseSchema:
+		// Properties left over by unevaluatedProperties
+		return []schemaProblem{{pointer: pointer, msg: "property is not allowed", notAllowed: true}}
+	case *kind.Required:
+		problem := schemaProblem{pointer: pointer, msg: k.LocalizedString(r.printer), required: true}
+		if len(k.Missing) == 1 {
+			problem.missing = k.Missing
+		}
+		return []schemaProblem{problem}
+	case *kind.Type:
+		return []schemaProblem{{pointer: pointer, got: k.Got, want: k.Want}}
+	}
+	if len(err.Causes) == 0 {
+		return []schemaProblem{{pointer: pointer, msg: err.ErrorKind.LocalizedString(r.printer)}}
+	}
+
+	// If an alternative failed, no properties were evaluated by it and
+	// unevaluatedProperties rejects all of them. Only properties the schema
+	// doesn't declare at all are reported then.
+	combinatorFailed := false
+	for _, cause := range err.Causes {
+		switch cause.ErrorKind.(type) {
+		case *kind.OneOf, *kind.AnyOf, *kind.AllOf:
+			combinatorFailed = true
+		}
+	}
+	var problems []schemaProblem
+	for _, cause := range err.Causes {
+		if _, ok := cause.ErrorKind.(*kind.FalseSchema); ok && combinatorFailed && len(cause.InstanceLocation) > 0 {
+			property := cause.InstanceLocation[len(cause.InstanceLocation)-1]
+			if r.declares(r.schemas[err.SchemaURL], property) {
+				continue
+			}
+		}
+		problems = append(problems, r.problems(cause)...)
+	}
+	return problems
+}
+
+// closestAlternative returns the problems of the failed alternative of a
+// oneOf or anyOf that declares and allows most properties of the value. Of
+// those it
+// prefers alternatives whose required properties are set, then the fewest
+// problems. Alternatives failing for a single missing property or wrong type
+// are reported together.
+func (r *schemaReporter) closestAlternative(err *jsonschema.ValidationError) []schemaProblem {
+	pointer := instancePointer(err.InstanceLocation)
+	var keys []string
+	if node, getErr := r.doc.Get(pointer); getErr == nil {
+		for _, member := range node.Members {
+			keys = append(keys, member.Key)
+		}
+	}
+	var branches []*jsonschema.Schema
+	if parent := r.schemas[err.SchemaURL]; parent != nil {
+		branches = slices.Concat(parent.OneOf, parent.AnyOf)
+	}
+
+	var closest [][]schemaProblem
+	best := -1
+	for _, cause := range err.Causes {
+		problems := r.problems(cause)
+		notAllowed := make(map[string]bool)
+		for _, p := range problems {
+			if p.notAllowed {
+				notAllowed[p.pointer] = true
+			}
+		}
+		branch := alternativeSchema(branches, cause.SchemaURL)
+		if branch == nil {
+			branch = r.schemas[cause.SchemaURL]
+		}
+		score := 0
+		for _, key := range keys {
+			if r.declares(branch, key) && !notAllowed[pointer+"/"+jsonc.EscapePointer(key)] {
+				score++
+			}
+		}
+		if score < best {
+			continue
+		}
+		if score > best {
+			best, closest = score, nil
+		}
+		closest = append(closest, problems)
+	}
+
+	if merged, ok := mergeAlternatives(closest); ok {
+		return []schemaProblem{merged}
+	}
+	missing := func(problems []schemaProblem) int {
+		n := 0
+		for _, p := range problems {
+			if p.required && p.pointer == pointer {
+				n++
+			}
+		}
+		return n
+	}
+	fewest := closest[0]
+	for _, problems := range closest[1:] {
+		if m, f := missing(problems), missing(fewest); m < f || (m == f && len(problems) < len(fewest)) {
+			fewest = problems
+		}
+	}
+	return fewest
+}
+
+// alternativeSchema returns the alternative of branches at location, or
+// containing it. Errors of an alternative may be located in its subschemas.
+func alternativeSchema(branches []*jsonschema.Schema, location string) *jsonschema.Schema {
+	for _, branch := range branches {
+		if location == branch.Location || strings.HasPrefix(location, branch.Location+"/") {
+			return branch
+		}
+	}
+	return nil
+}
+
+// mergeAlternatives merges alternatives that each fail for a single missing
+// property or a wrong type of the same value
+func mergeAlternatives(alternatives [][]schemaProblem) (schemaProblem, bool) {
+	if len(alternatives) < 2 {
+		return schemaProblem{}, false
+	}
+	var merged schemaProblem
+	for i, problems := range alternatives {
+		if len(problems) != 1 {
+			return schemaProblem{}, false
+		}
+		p := problems[0]
+		if i == 0 {
+			merged = p
+			continue
+		}
+		switch {
+		case p.pointer != merged.pointer:
+			return schemaProblem{}, false
+		case len(p.missing) > 0 && len(merged.missing) > 0:
+			merged.missing = appendMissing(merged.missing, p.missing...)
+		case len(p.want) > 0 && len(merged.want) > 0 && p.got == merged.got:
+			merged.want = appendMissing(merged.want, p.want...)
+		default:
+			return schemaProblem{}, false
+		}
+	}
+	return merged, true
+}
+
+// appendMissing appends the values not in list yet
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// declares reports whether schema, or one of the subschemas it references or
+// combines, declares property
+func (r *schemaReporter) declares(schema *jsonschema.Schema, property string) bool {
+	if schema == nil {
+		return false
+	}
+	return r.declaredProperties(schema)[property]
+}
+
+func (r *schemaReporter) declaredProperties(schema *jsonschema.Schema) map[string]bool {
+	if declared, ok := r.declared[schema]; ok {
+		return declared
+	}
+	declared := make(map[string]bool)
+	// Recursive references see the properties found so far
+	r.declared[schema] = declared
+	for property := range schema.Properties {
+		declared[property] = true
+	}
+	for _, sub := range slices.Concat([]*jsonschema.Schema{schema.Ref}, schema.AllOf, schema.AnyOf, schema.OneOf) {
+		if sub == nil {
+			continue
+		}
+		for property := range r.declaredProperties(sub) {
+			declared[property] = true
+		}
+	}
+	return declared
+}
+
+// indexSchemas maps the locations of schema and its subschemas to them
+func indexSchemas(schema *jsonschema.Schema) map[string]*jsonschema.Schema {
+	index := make(map[string]*jsonschema.Schema)
+	var visit func(s *jsonschema.Schema)
+	visit = func(s *jsonschema.Schema) {
+		if s == nil || index[s.Location] != nil {
+			return
+		}
+		index[s.Location] = s
+		subschemas := slices.Concat([]*jsonschema.Schema{s.Ref, s.Not, s.If, s.Then, s.Else, s.PropertyNames,
+			s.UnevaluatedProperties, s.Items2020, s.Contains, s.UnevaluatedItems}, s.AllOf, s.AnyOf, s.OneOf, s.PrefixItems)
+		for _, sub := range s.Properties {
+			subschemas = append(subschemas, sub)
+		}
+		for _, sub := range s.PatternProperties {
+			subschemas = append(subschemas, sub)
+		}
+		for _, sub := range s.DependentSchemas {
+			subschemas = append(subschemas, sub)
+		}
+		for _, v := range []any{s.AdditionalProperties, s.Items, s.AdditionalItems} {
+			switch v := v.(type) {
+			case *jsonschema.Schema:
+				subschemas = append(subschemas, v)
+			case []*jsonschema.Schema:
+				subschemas = append(subschemas, v...)
+			}
+		}
+		for _, sub := range subschemas {
+			visit(sub)
+		}
+	}
+	visit(schema)
+	return index
+}
+
+// instancePointer formats an instance location as a JSON pointer
+func instancePointer(location []string) string {
+	var b strings.Builder
+	for _, token := range location {
+		b.WriteString("/" + jsonc.EscapePointer(token))
+	}
+	return b.String()
+}
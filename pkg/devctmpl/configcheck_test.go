@@ -0,0 +1,131 @@
+package devctmpl_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestCheckConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name: "valid",
+			config: `{
+	// Go development
+	"name": "Go",
+	"build": {"dockerfile": "Dockerfile", "args": {"VARIANT": "1.22"}},
+	"features": {"ghcr.io/devcontainers/features/node:1": {}},
+	"forwardPorts": [8080, "db:5432"],
+	"postCreateCommand": ["go", "mod", "download"],
+	"mounts": [{"type": "volume", "source": "cache", "target": "/cache"}],
+}`,
+		},
+		{
+			name: "unknown property",
+			config: `{
+	"name": "go",
+	"imagee": "go",
+	"build": {
+		"dockerfile": "Dockerfile",
+		"dockerFile": "Dockerfile"
+	}
+}`,
+			want: []string{
+				"3: error: /imagee: property is not allowed [config-schema]",
+				"6: error: /build/dockerFile: property is not allowed [config-schema]",
+			},
+		},
+		{
+			name: "wrong type",
+			config: `{
+	"image": "go",
+	"forwardPorts": [
+		8080,
+		true
+	],
+	"shutdownAction": "halt"
+}`,
+			want: []string{
+				"5: error: /forwardPorts/1: got boolean, want integer or string [config-schema]",
+				"7: error: /shutdownAction: value must be one of",
+			},
+		},
+		{
+			name:   "compose without service",
+			config: "{\n\t\"dockerComposeFile\": \"compose.yml\"\n}",
+			want:   []string{"1: error: /: missing properties 'service', 'workspaceFolder' [config-schema]"},
+		},
+		{
+			name:   "image and compose",
+			config: "{\n\t\"image\": \"go\",\n\t\"dockerComposeFile\": \"compose.yml\",\n\t\"service\": \"app\",\n\t\"workspaceFolder\": \"/workspace\"\n}",
+			want:   []string{"1: error: /: 'oneOf' failed, subschemas 0, 1 matched [config-schema]"},
+		},
+		{
+			name:   "no container",
+			config: "{\n\t\"name\": \"go\"\n}",
+			want:   []string{"1: error: /: missing property 'build', 'dockerFile' or 'image' [config-schema]"},
+		},
+		{
+			name:   "tool customizations",
+			config: "{\n\t\"image\": \"go\",\n\t\"customizations\": {\"vscode\": {\"extensions\": [\"golang.go\"]}}\n}",
+		},
+		{
+			name:   "byte order mark",
+			config: "\xEF\xBB\xBF{\n\t\"image\": \"go\"\n}",
+		},
+		{
+			name:   "syntax",
+			config: "{\n\t\"image\": \"go\",\n\t\"image\": \"go\"\n}",
+			want:   []string{"3: error: line 3, column 2: duplicate key 'image' [config-syntax]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := filepath.Join(dir, ".devcontainer", "devcontainer.json")
+			writeFile(t, config, tt.config)
+
+			issues, err := devctmpl.CheckConfigs(dir)
+			if err != nil {
+				t.Fatalf("CheckConfigs() error = %v", err)
+			}
+			if len(issues) != len(tt.want) {
+				t.Fatalf("CheckConfigs() = %v, want %d issues", issues, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := issues[i].String(); !strings.HasPrefix(got, config+":"+want) {
+					t.Errorf("issue %d = %q, want prefix %q", i, got, config+":"+want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateSchema(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "schema", "version": "1.0.0", "name": "Schema"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), "{\n\t\"image\": \"go\",\n\t\"remoteUser\": 1000\n}")
+
+	var issues []devctmpl.Issue
+	config := devctmpl.NewConfig()
+	config.OnIssue = func(issue devctmpl.Issue) { issues = append(issues, issue) }
+	if err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), nil, config); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+	if len(issues) != 1 || issues[0].Rule != "config-schema" || issues[0].Line != 3 {
+		t.Errorf("OnIssue got %v, want a config-schema issue on line 3", issues)
+	}
+
+	config.Strict = true
+	err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), nil, config)
+	if err == nil || !strings.Contains(err.Error(), ".devcontainer/devcontainer.json:3: error: /remoteUser: got number, want string") {
+		t.Errorf("GenerateTemplateWithConfig() error = %v, want schema error", err)
+	}
+}
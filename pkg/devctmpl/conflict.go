@@ -0,0 +1,211 @@
+package devctmpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy decides what happens to existing target files that differ
+// from the rendered template. Identical files are always left alone.
+type ConflictPolicy string
+
+const (
+	// ConflictFail refuses to apply the template if any file conflicts. It is
+	// the default.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip keeps the existing file
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing file
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictBackup renames the existing file to <name>.orig before writing
+	ConflictBackup ConflictPolicy = "backup"
+	// ConflictPrompt asks Config.Prompt for every conflicting file
+	ConflictPrompt ConflictPolicy = "prompt"
+)
+
+// backupSuffix is appended to the names of backed up files
+const backupSuffix = ".orig"
+
+// ConflictPromptFunc chooses the policy for a single conflicting file. file
+// includes a diff of the change. Returning ConflictFail aborts the apply.
+type ConflictPromptFunc func(file PlannedFile) (ConflictPolicy, error)
+
+func (p ConflictPolicy) validate() error {
+	switch p {
+	case "", ConflictFail, ConflictSkip, ConflictOverwrite, ConflictBackup, ConflictPrompt:
+		return nil
+	default:
+		return fmt.Errorf("unsupported conflict policy '%s' (supported policies: fail, skip, overwrite, backup, prompt)", p)
+	}
+}
+
+// applyRendered writes the rendered template to target in a transaction,
+// resolving conflicts with existing files according to cfg.OnConflict, and
+// records the applied state
+func applyRendered(ctx context.Context, rendered *renderedTemplate, target string, cfg Config) (err error) {
+	if err := cfg.OnConflict.validate(); err != nil {
+		return err
+	}
+	if cfg.OnConflict == ConflictPrompt && cfg.Prompt == nil {
+		return fmt.Errorf("conflict policy 'prompt' requires a prompt function")
+	}
+	if cfg.TargetSubdir != "" {
+		subdir, err := cleanSubdir(cfg.TargetSubdir)
+		if err != nil {
+			return err
+		}
+		if err := checkSubdirInside(target, subdir); err != nil {
+			return err
+		}
+	}
+
+	dir, err := stateDir(cfg.TargetSubdir, cfg.AsConfig)
+	if err != nil {
+		return err
+	}
+
+	plan, err := buildPlan(rendered, target)
+	if err != nil {
+		return err
+	}
+
+	if cfg.OnConflict == ConflictFail || cfg.OnConflict == "" {
+		var conflicts []string
+		for _, file := range plan.Files {
+			if file.Action == ActionModify {
+				conflicts = append(conflicts, file.Path)
+			}
+		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("files already exist in target directory and differ from the template: %s (choose a conflict policy to apply anyway)", strings.Join(conflicts, ", "))
+		}
+	}
+
+	tx, err := beginTransaction(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.rollback(); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+		}
+	}()
+
+	j, err := openJournal(tx, dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range plan.Files {
+		src := filepath.Join(rendered.dir, filepath.FromSlash(file.Path))
+
+		switch file.Action {
+		case ActionCreate:
+			if err := writeRenderedFile(j, src, file.Path); err != nil {
+				return err
+			}
+		case ActionModify:
+			policy := cfg.OnConflict
+			if policy == ConflictPrompt {
+				if policy, err = cfg.Prompt(file); err != nil {
+					return err
+				}
+			}
+			if err := resolveConflict(j, policy, src, file.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Record what was applied for later upgrades and reverts
+	state, err := newState(rendered, cfg)
+	if err != nil {
+		return err
+	}
+	if err := j.writeState(state); err != nil {
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+func resolveConflict(j *journal, policy ConflictPolicy, src string, rel string) error {
+	dst := j.tx.path(rel)
+
+	switch policy {
+	case ConflictSkip:
+		return nil
+	case ConflictOverwrite:
+		return writeRenderedFile(j, src, rel)
+	case ConflictBackup:
+		backup, err := backupPath(dst)
+		if err != nil {
+			return err
+		}
+		backupRel := path.Join(path.Dir(rel), filepath.Base(backup))
+		existing, err := os.ReadFile(dst)
+		if err != nil {
+			return err
+		}
+		if err := j.record(rel); err != nil {
+			return err
+		}
+		if err := j.record(backupRel); err != nil {
+			return err
+		}
+		if err := j.tx.rename(rel, backupRel); err != nil {
+			return err
+		}
+		if err := j.written(backupRel, existing); err != nil {
+			return err
+		}
+		return writeRenderedFile(j, src, rel)
+	case ConflictFail, "":
+		return fmt.Errorf("file '%s' already exists in target directory and differs from the template", rel)
+	default:
+		return fmt.Errorf("unsupported conflict policy '%s' for '%s'", policy, rel)
+	}
+}
+
+// backupPath returns a free backup name for path: path.orig, or
+// path.orig.N if earlier backups exist
+func backupPath(path string) (string, error) {
+	candidate := path + backupSuffix
+	for i := 1; ; i++ {
+		_, err := os.Lstat(candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%s.%d", path, backupSuffix, i)
+	}
+}
+
+// writeRenderedFile copies the rendered file src to rel in the workspace
+func writeRenderedFile(j *journal, src string, rel string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := j.record(rel); err != nil {
+		return err
+	}
+	if err := j.mkdirAll(path.Dir(rel)); err != nil {
+		return err
+	}
+	// The existing file is replaced, not written through, so symlinks in the
+	// workspace are not followed
+	if err := j.tx.copyFile(src, rel); err != nil {
+		return err
+	}
+	return j.written(rel, data)
+}
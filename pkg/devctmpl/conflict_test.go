@@ -0,0 +1,136 @@
+package devctmpl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestGenerateTemplateConflicts(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "conflict", "version": "1.0.0", "name": "Conflict"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:12"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/Dockerfile"), "FROM debian:12\n")
+	writeFile(t, filepath.Join(src, "new.txt"), "new\n")
+
+	tests := []struct {
+		name     string
+		policy   devctmpl.ConflictPolicy
+		prompt   devctmpl.ConflictPromptFunc
+		existing map[string]string
+		want     map[string]string
+		wantErr  string
+	}{
+		{
+			name:     "fail leaves target untouched",
+			policy:   devctmpl.ConflictFail,
+			existing: map[string]string{".devcontainer/devcontainer.json": `{"image": "custom"}`},
+			want:     map[string]string{".devcontainer/devcontainer.json": `{"image": "custom"}`},
+			wantErr:  ".devcontainer/devcontainer.json",
+		},
+		{
+			name:     "empty policy fails",
+			existing: map[string]string{".devcontainer/devcontainer.json": `{"image": "custom"}`},
+			wantErr:  "differ from the template",
+		},
+		{
+			name:     "identical files are no-ops",
+			policy:   devctmpl.ConflictFail,
+			existing: map[string]string{".devcontainer/Dockerfile": "FROM debian:12\n"},
+			want:     map[string]string{".devcontainer/Dockerfile": "FROM debian:12\n", "new.txt": "new\n"},
+		},
+		{
+			name:     "skip",
+			policy:   devctmpl.ConflictSkip,
+			existing: map[string]string{".devcontainer/devcontainer.json": `{"image": "custom"}`},
+			want:     map[string]string{".devcontainer/devcontainer.json": `{"image": "custom"}`, "new.txt": "new\n"},
+		},
+		{
+			name:     "overwrite",
+			policy:   devctmpl.ConflictOverwrite,
+			existing: map[string]string{".devcontainer/devcontainer.json": `{"image": "custom"}`},
+			want:     map[string]string{".devcontainer/devcontainer.json": `{"image": "debian:12"}`},
+		},
+		{
+			name:   "backup",
+			policy: devctmpl.ConflictBackup,
+			existing: map[string]string{
+				".devcontainer/devcontainer.json":      `{"image": "custom"}`,
+				".devcontainer/devcontainer.json.orig": `{"image": "older"}`,
+			},
+			want: map[string]string{
+				".devcontainer/devcontainer.json":        `{"image": "debian:12"}`,
+				".devcontainer/devcontainer.json.orig":   `{"image": "older"}`,
+				".devcontainer/devcontainer.json.orig.1": `{"image": "custom"}`,
+			},
+		},
+		{
+			name:   "prompt",
+			policy: devctmpl.ConflictPrompt,
+			prompt: func(file devctmpl.PlannedFile) (devctmpl.ConflictPolicy, error) {
+				if file.Path == "new.txt" {
+					return devctmpl.ConflictSkip, nil
+				}
+				return devctmpl.ConflictOverwrite, nil
+			},
+			existing: map[string]string{
+				".devcontainer/devcontainer.json": `{"image": "custom"}`,
+				"new.txt":                         "mine\n",
+			},
+			want: map[string]string{
+				".devcontainer/devcontainer.json": `{"image": "debian:12"}`,
+				"new.txt":                         "mine\n",
+			},
+		},
+		{
+			name:     "prompt without function",
+			policy:   devctmpl.ConflictPrompt,
+			existing: map[string]string{},
+			wantErr:  "requires a prompt function",
+		},
+		{
+			name:    "unknown policy",
+			policy:  "merge",
+			wantErr: "unsupported conflict policy 'merge'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := t.TempDir()
+			for name, content := range tt.existing {
+				writeFile(t, filepath.Join(target, name), content)
+			}
+
+			config := devctmpl.NewConfig()
+			config.OnConflict = tt.policy
+			config.Prompt = tt.prompt
+			err := devctmpl.GenerateTemplateWithConfig(src, target, nil, config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GenerateTemplateWithConfig() error = %v, want error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+			}
+
+			for name, want := range tt.want {
+				got, err := os.ReadFile(filepath.Join(target, name))
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", name, err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if tt.wantErr != "" {
+				if _, err := os.Stat(filepath.Join(target, "new.txt")); !os.IsNotExist(err) && tt.existing["new.txt"] == "" {
+					t.Errorf("failed apply created new.txt")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package devctmpl
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// escapeContext describes where a template variable sits within a file
+type escapeContext int
+
+const (
+	// contextRaw inserts values as they are
+	contextRaw escapeContext = iota
+	// contextJSONString is inside a JSON or JSONC string literal
+	contextJSONString
+	// contextYAMLDouble is inside a double quoted YAML scalar
+	contextYAMLDouble
+	// contextYAMLSingle is inside a single quoted YAML scalar
+	contextYAMLSingle
+	// contextYAMLPlain is at the start of a plain (unquoted) YAML scalar
+	contextYAMLPlain
+)
+
+// optionFilters are the explicit escaping filters that can be requested with
+// ${templateOption:key|filter}. They take precedence over the file type.
+var optionFilters = map[string]func(string) string{
+	"raw":        func(s string) string { return s },
+	"json":       jsonEscape,
+	"shellquote": shellQuote,
+}
+
+// contextScanner tracks the lexical state of a file so that the escaping
+// context of a template variable can be determined
+type contextScanner interface {
+	// scan advances the scanner over b
+	scan(b []byte)
+	// context returns the escaping context at the current position
+	context() escapeContext
+}
+
+// newContextScanner returns a scanner for the file type of name, or nil if
+// values are inserted into such files without escaping
+func newContextScanner(name string) contextScanner {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".jsonc":
+		return &jsonScanner{}
+	case ".yml", ".yaml":
+		return &yamlScanner{scalarStart: true}
+	}
+	return nil
+}
+
+// escapeValue escapes value for ctx. rest is the remainder of the line after
+// the template variable, used to decide whether a plain YAML scalar needs quotes.
+func escapeValue(ctx escapeContext, value string, rest []byte) string {
+	switch ctx {
+	case contextJSONString, contextYAMLDouble:
+		return jsonEscape(value)
+	case contextYAMLSingle:
+		return strings.ReplaceAll(value, "'", "''")
+	case contextYAMLPlain:
+		rest = bytes.TrimSpace(rest)
+		wholeScalar := len(rest) == 0 || rest[0] == '#'
+		if wholeScalar && yamlNeedsQuoting(value) {
+			return `"` + jsonEscape(value) + `"`
+		}
+	}
+	return value
+}
+
+// jsonEscape escapes s for use inside a JSON string literal, without the
+// surrounding quotes
+func jsonEscape(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Encoding a string can't fail
+	_ = enc.Encode(s)
+	out := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return string(out[1 : len(out)-1])
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// yamlNeedsQuoting reports whether s can't be written as a plain YAML scalar
+// without changing the structure of the document. Values that merely look
+// like booleans or numbers are left alone, since templates rely on that.
+func yamlNeedsQuoting(s string) bool {
+	if s == "" {
+		return false
+	}
+	if strings.TrimSpace(s) != s {
+		return true
+	}
+	if strings.ContainsAny(s, "\n\r\t") || strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return true
+	}
+	if strings.HasSuffix(s, ":") {
+		return true
+	}
+	return strings.ContainsRune("-?:,[]{}#&*!|>'\"%@`", rune(s[0]))
+}
+
+// jsonScanner follows string literals and comments in JSON and JSONC files
+type jsonScanner struct {
+	inString     bool
+	escaped      bool
+	lineComment  bool
+	blockComment bool
+	prev         byte
+}
+
+func (s *jsonScanner) scan(b []byte) {
+	for _, c := range b {
+		switch {
+		case s.lineComment:
+			if c == '\n' {
+				s.lineComment = false
+			}
+		case s.blockComment:
+			if c == '/' && s.prev == '*' {
+				s.blockComment = false
+				c = 0
+			}
+		case s.inString:
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"' || c == '\n':
+				s.inString = false
+			}
+		default:
+			switch {
+			case c == '"':
+				s.inString = true
+			case c == '/' && s.prev == '/':
+				s.lineComment = true
+			case c == '*' && s.prev == '/':
+				s.blockComment = true
+				c = 0
+			}
+		}
+		s.prev = c
+	}
+}
+
+func (s *jsonScanner) context() escapeContext {
+	if s.inString {
+		return contextJSONString
+	}
+	return contextRaw
+}
+
+// yamlScanner follows quoted scalars and comments in YAML files. Block
+// scalars and flow collections spanning lines are treated as plain text.
+type yamlScanner struct {
+	inDouble    bool
+	inSingle    bool
+	escaped     bool
+	comment     bool
+	scalarStart bool
+	prev        byte
+}
+
+func (s *yamlScanner) scan(b []byte) {
+	for _, c := range b {
+		switch {
+		case s.comment:
+			if c == '\n' {
+				s.comment = false
+				s.scalarStart = true
+			}
+		case s.inDouble:
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"':
+				s.inDouble = false
+			}
+		case s.inSingle:
+			if c == '\'' {
+				s.inSingle = false
+			}
+		default:
+			switch {
+			case c == '\n':
+				s.scalarStart = true
+			case c == ' ' || c == '\t':
+				// A scalar starts after an indicator followed by a space
+				if s.prev == ':' || s.prev == '-' || s.prev == '?' {
+					s.scalarStart = true
+				}
+			case c == '#' && (s.scalarStart || s.prev == ' ' || s.prev == '\t'):
+				s.comment = true
+			case c == '"' && s.scalarStart:
+				s.inDouble = true
+				s.scalarStart = false
+			case c == '\'' && s.scalarStart:
+				s.inSingle = true
+				s.scalarStart = false
+			case c == '[' || c == '{' || c == ',':
+				s.scalarStart = true
+			default:
+				s.scalarStart = false
+			}
+		}
+		s.prev = c
+	}
+}
+
+func (s *yamlScanner) context() escapeContext {
+	switch {
+	case s.inDouble:
+		return contextYAMLDouble
+	case s.inSingle:
+		return contextYAMLSingle
+	case s.comment:
+		return contextRaw
+	case s.scalarStart:
+		return contextYAMLPlain
+	}
+	return contextRaw
+}
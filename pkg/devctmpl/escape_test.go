@@ -0,0 +1,130 @@
+package devctmpl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestGenerateTemplateEscaping(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		input string
+		value string
+		want  string
+	}{
+		{
+			name:  "json string",
+			file:  ".devcontainer/devcontainer.json",
+			input: `{"name": "${templateOption:v}", "n": ${templateOption:v}} // ${templateOption:v}`,
+			value: `a "b" \c`,
+			want:  `{"name": "a \"b\" \\c", "n": a "b" \c} // a "b" \c`,
+		},
+		{
+			name:  "jsonc block comment",
+			file:  ".devcontainer/devcontainer.json",
+			input: "/* \"\n*/ {\"name\": \"${templateOption:v}\"}",
+			value: `"x"`,
+			want:  "/* \"\n*/ {\"name\": \"\\\"x\\\"\"}",
+		},
+		{
+			name:  "yaml plain scalar",
+			file:  "docker-compose.yml",
+			input: "image: ${templateOption:v}\ncommand: run ${templateOption:v}\n",
+			value: "a: b",
+			want:  "image: \"a: b\"\ncommand: run a: b\n",
+		},
+		{
+			name:  "yaml quoted scalars",
+			file:  "docker-compose.yaml",
+			input: "a: \"${templateOption:v}\"\nb: '${templateOption:v}'\nc: ${templateOption:v} # comment\n",
+			value: `it's "x"`,
+			want:  "a: \"it's \\\"x\\\"\"\nb: 'it''s \"x\"'\nc: it's \"x\" # comment\n",
+		},
+		{
+			name:  "yaml typed values",
+			file:  "docker-compose.yml",
+			input: "privileged: ${templateOption:v}\n",
+			value: "true",
+			want:  "privileged: true\n",
+		},
+		{
+			name:  "shell is not escaped",
+			file:  ".devcontainer/postCreate.sh",
+			input: "echo ${templateOption:v}\necho ${templateOption:v|shellquote}\n",
+			value: "it's",
+			want:  "echo it's\necho 'it'\\''s'\n",
+		},
+		{
+			name:  "explicit raw filter",
+			file:  ".devcontainer/devcontainer.json",
+			input: `{"name": "${templateOption:v|raw}"}`,
+			value: `"x"`,
+			want:  `{"name": ""x""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+				"id": "escape", "version": "1.0.0", "name": "Escape",
+				"options": {"v": {"type": "string", "description": "Value"}},
+				"optionalPaths": ["docker-compose.yml", "docker-compose.yaml"]
+			}`)
+			if tt.file != ".devcontainer/devcontainer.json" {
+				writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), "{}")
+			}
+			writeFile(t, filepath.Join(src, tt.file), tt.input)
+
+			target := t.TempDir()
+			if err := devctmpl.GenerateTemplate(src, target, map[string]string{"v": tt.value}); err != nil {
+				t.Fatalf("GenerateTemplate() error = %v", err)
+			}
+			got, err := os.ReadFile(filepath.Join(target, tt.file))
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateUnknownFilter(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "escape", "version": "1.0.0", "name": "Escape",
+		"options": {"v": {"type": "string", "description": "Value"}}
+	}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), "{\n\"name\": \"${templateOption:v|nope}\"\n}")
+
+	if err := devctmpl.GenerateTemplate(src, t.TempDir(), map[string]string{"v": "x"}); err == nil {
+		t.Fatal("expected error for unknown filter")
+	}
+}
+
+func TestGenerateTemplateStrict(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "strict", "version": "1.0.0", "name": "Strict",
+		"options": {"v": {"type": "string", "description": "Value"}}
+	}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), "{\n\t// comment\n\t\"name\": ${templateOption:v|raw},\n\t\"image\": \"debian:12\",\n}")
+
+	config := devctmpl.NewConfig()
+	config.Strict = true
+	if err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), map[string]string{"v": `"ok"`}, config); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+
+	err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), map[string]string{"v": `"a", "name": "b"`}, config)
+	if err == nil || !strings.Contains(err.Error(), "line 3, column 15: duplicate key 'name'") {
+		t.Errorf("GenerateTemplateWithConfig() error = %v, want duplicate key error", err)
+	}
+}
@@ -0,0 +1,22 @@
+package devctmpl
+
+import (
+	"io/fs"
+	"testing"
+)
+
+// SetRename replaces the rename used to move files into place for the
+// duration of a test
+func SetRename(t testing.TB, rename func(oldpath, newpath string) error) {
+	old := osRename
+	osRename = rename
+	t.Cleanup(func() { osRename = old })
+}
+
+// SetWriteFile replaces the function used to stage file content for the
+// duration of a test
+func SetWriteFile(t testing.TB, write func(name string, data []byte, perm fs.FileMode) error) {
+	old := osWriteFile
+	osWriteFile = write
+	t.Cleanup(func() { osWriteFile = old })
+}
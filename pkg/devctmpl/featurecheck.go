@@ -0,0 +1,175 @@
+package devctmpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// FeatureRules are the checks run by CheckFeatures
+var FeatureRules = []Rule{
+	{ID: "unknown-feature", Description: "Every OCI feature reference resolves to a published feature"},
+	{ID: "unknown-feature-option", Description: "Feature options are defined by the feature"},
+	{ID: "invalid-feature-option", Description: "Feature option values match the option type and enum"},
+}
+
+// FeatureResolver fetches the metadata of features from OCI registries. The
+// results are cached by reference, so every feature is fetched once.
+// Failures are not cached and retried by the next call. A resolver may be
+// used concurrently; concurrent calls for the same reference share a fetch.
+type FeatureResolver struct {
+	mu    sync.Mutex
+	cache map[string]*resolvedFeature
+}
+
+type resolvedFeature struct {
+	// done is closed once the fetch completed
+	done     chan struct{}
+	metadata *FeatureMetadata
+	digest   string
+	err      error
+}
+
+// NewFeatureResolver creates a FeatureResolver with an empty cache
+func NewFeatureResolver() *FeatureResolver {
+	return &FeatureResolver{cache: make(map[string]*resolvedFeature)}
+}
+
+// defaultFeatureResolver is used when Config.FeatureResolver is not set
+var defaultFeatureResolver = NewFeatureResolver()
+
+// Resolve returns the devcontainer-feature.json and the manifest digest of
+// the feature published at the OCI reference id
+func (r *FeatureResolver) Resolve(id string) (*FeatureMetadata, string, error) {
+	r.mu.Lock()
+	resolved, ok := r.cache[id]
+	if !ok {
+		resolved = &resolvedFeature{done: make(chan struct{})}
+		r.cache[id] = resolved
+	}
+	r.mu.Unlock()
+	if ok {
+		<-resolved.done
+		return resolved.metadata, resolved.digest, resolved.err
+	}
+
+	// The lock is not held while fetching, so other features are resolved
+	// in the meantime
+	resolved.metadata, resolved.digest, resolved.err = fetchFeatureMetadata(id)
+	if resolved.err != nil {
+		r.mu.Lock()
+		delete(r.cache, id)
+		r.mu.Unlock()
+	}
+	close(resolved.done)
+	return resolved.metadata, resolved.digest, resolved.err
+}
+
+// fetchFeatureMetadata pulls the feature published at the OCI reference id
+// and parses its devcontainer-feature.json
+func fetchFeatureMetadata(id string) (*FeatureMetadata, string, error) {
+	data, digest, err := pullOCIFeature(id)
+	if err != nil {
+		return nil, "", err
+	}
+	var metadata FeatureMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, "", fmt.Errorf("failed to parse devcontainer-feature.json of '%s': %w", id, err)
+	}
+	return &metadata, digest, nil
+}
+
+// CheckFeatures checks the features used by the devcontainer.json files in
+// dir: OCI features must resolve, and their options must be defined by the
+// feature with allowed values. File paths in issues are joined with dir. If
+// resolver is nil a shared resolver is used.
+func CheckFeatures(dir string, resolver *FeatureResolver) ([]Issue, error) {
+	issues, err := checkFeatures(dir, resolver)
+	for i := range issues {
+		issues[i].File = filepath.Join(dir, filepath.FromSlash(issues[i].File))
+	}
+	return issues, err
+}
+
+// checkFeatures is CheckFeatures with file paths relative to dir
+func checkFeatures(dir string, resolver *FeatureResolver) ([]Issue, error) {
+	if resolver == nil {
+		resolver = defaultFeatureResolver
+	}
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	for _, config := range configs {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(config.Path)))
+		if err != nil {
+			return nil, err
+		}
+		doc, err := jsonc.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", config.Path, err)
+		}
+		features, err := doc.Get("/features")
+		if err != nil || features.Kind != jsonc.Object {
+			continue
+		}
+
+		report := func(rule string, node *jsonc.Node, format string, args ...any) {
+			line, _ := doc.Position(node)
+			issues = append(issues, Issue{
+				Rule:     rule,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf(format, args...),
+				File:     config.Path,
+				Line:     line,
+			})
+		}
+		for _, member := range features.Members {
+			if !isOCIFeature(member.Key) {
+				continue
+			}
+			metadata, _, err := resolver.Resolve(member.Key)
+			if err != nil {
+				report("unknown-feature", member.Value, "feature '%s' could not be resolved: %v", member.Key, err)
+				continue
+			}
+			if member.Value.Kind != jsonc.Object {
+				continue
+			}
+
+			var options map[string]any
+			if err := member.Value.Decode(&options); err != nil {
+				return nil, fmt.Errorf("invalid options of feature '%s' in %s: %w", member.Key, config.Path, err)
+			}
+			for _, problem := range metadata.checkOptions(options) {
+				node := member.Value
+				if option := member.Value.Member(problem.option); option != nil {
+					node = option.Value
+				}
+				report(problem.rule, node, "feature '%s': %s", member.Key, problem.message)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// issuesError returns an error listing the issues with error severity, or nil
+func issuesError(message string, issues []Issue) error {
+	var lines []string
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			lines = append(lines, "  "+issue.String())
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s:\n%s", message, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,328 @@
+package devctmpl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// Feature is a dev container feature added to the generated configuration
+type Feature struct {
+	// ID is the feature reference, e.g. ghcr.io/devcontainers/features/go:1
+	ID      string         `json:"id"`
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// addFeatures adds the features to every devcontainer.json in dir
+func addFeatures(dir string, features []Feature) error {
+	if len(features) == 0 {
+		return nil
+	}
+	for i, feature := range features {
+		if feature.ID == "" {
+			return fmt.Errorf("feature %d has no id", i)
+		}
+	}
+
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		name := filepath.Join(dir, filepath.FromSlash(config.Path))
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		doc, err := jsonc.Parse(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", config.Path, err)
+		}
+		for _, feature := range features {
+			if err := setFeature(doc, feature.ID, feature.Options); err != nil {
+				return fmt.Errorf("failed to add feature '%s' to %s: %w", feature.ID, config.Path, err)
+			}
+		}
+		if err := os.WriteFile(name, doc.Bytes(), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFeature adds the feature id to the features object of doc. The options
+// of an existing entry are merged, a version string becomes the version
+// option.
+func setFeature(doc *jsonc.Document, id string, options map[string]any) error {
+	pointer := "/features/" + jsonc.EscapePointer(id)
+	existing, err := doc.Get(pointer)
+	if err != nil {
+		if options == nil {
+			options = map[string]any{}
+		}
+		return doc.Set(pointer, options)
+	}
+
+	if existing.Kind != jsonc.Object {
+		if len(options) == 0 {
+			return nil
+		}
+		merged := map[string]any{}
+		if existing.Kind == jsonc.String {
+			merged["version"] = existing.String()
+		}
+		for key, value := range options {
+			merged[key] = value
+		}
+		return doc.Set(pointer, merged)
+	}
+
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := doc.Set(pointer+"/"+jsonc.EscapePointer(key), options[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FeatureMetadata is the devcontainer-feature.json of a feature
+type FeatureMetadata struct {
+	ID          string                   `json:"id"`
+	Version     string                   `json:"version"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Options     map[string]FeatureOption `json:"options,omitempty"`
+}
+
+// FeatureOption is an option of a feature
+type FeatureOption struct {
+	// Type is "string" or "boolean"
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Default     any      `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Proposals   []string `json:"proposals,omitempty"`
+}
+
+// FetchFeatureMetadata fetches the devcontainer-feature.json of the feature
+// published at the OCI reference id
+func FetchFeatureMetadata(id string) (*FeatureMetadata, error) {
+	metadata, _, err := defaultFeatureResolver.Resolve(id)
+	return metadata, err
+}
+
+// isOCIFeature reports whether the feature id is an OCI reference, rather
+// than a local folder or a tarball URL
+func isOCIFeature(id string) bool {
+	if strings.HasPrefix(id, ".") || strings.HasPrefix(id, "/") || strings.Contains(id, "://") {
+		return false
+	}
+	_, err := name.ParseReference(id)
+	return err == nil
+}
+
+// optionProblem is an option value that a feature doesn't accept
+type optionProblem struct {
+	option  string
+	rule    string
+	message string
+}
+
+// checkOptions returns a problem for every option that the feature doesn't
+// define or whose value is not allowed
+func (m *FeatureMetadata) checkOptions(options map[string]any) []optionProblem {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []optionProblem
+	report := func(key string, rule string, format string, args ...any) {
+		problems = append(problems, optionProblem{option: key, rule: rule, message: fmt.Sprintf(format, args...)})
+	}
+	for _, key := range keys {
+		option, ok := m.Options[key]
+		if !ok {
+			available := make([]string, 0, len(m.Options))
+			for k := range m.Options {
+				available = append(available, k)
+			}
+			sort.Strings(available)
+			report(key, "unknown-feature-option", "unknown option '%s' (available options: %s)", key, strings.Join(available, ", "))
+			continue
+		}
+
+		value := options[key]
+		switch option.Type {
+		case "boolean":
+			if s, ok := value.(string); ok && (s == "true" || s == "false") {
+				continue
+			}
+			if _, ok := value.(bool); !ok {
+				report(key, "invalid-feature-option", "option '%s' must be a boolean, got %v", key, value)
+			}
+		case "string":
+			s, ok := value.(string)
+			if !ok {
+				report(key, "invalid-feature-option", "option '%s' must be a string, got %v", key, value)
+			} else if len(option.Enum) > 0 && !slices.Contains(option.Enum, s) {
+				report(key, "invalid-feature-option", "invalid value '%s' for option '%s' (allowed values: %s)", s, key, strings.Join(option.Enum, ", "))
+			}
+		}
+	}
+	return problems
+}
+
+// workspaceConfig returns the path of the devcontainer.json of workspace,
+// the named sub-configuration if configName is set
+func workspaceConfig(workspace string, configName string) (string, error) {
+	configs, err := findDevContainerJson(workspace)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, config := range configs {
+		if configName == "" && len(configs) == 1 || configName != "" && config.Name == configName {
+			return filepath.Join(workspace, filepath.FromSlash(config.Path)), nil
+		}
+		if config.Name != "" {
+			names = append(names, config.Name)
+		}
+	}
+	if configName != "" {
+		return "", fmt.Errorf("configuration '%s' not found in '%s' (available configurations: %v)", configName, workspace, names)
+	}
+	return "", fmt.Errorf("'%s' has %d configurations, select one by name (available configurations: %v)", workspace, len(configs), names)
+}
+
+// readWorkspaceConfig parses the devcontainer.json of workspace
+func readWorkspaceConfig(workspace string, configName string) (string, *jsonc.Document, error) {
+	config, err := workspaceConfig(workspace, configName)
+	if err != nil {
+		return "", nil, err
+	}
+	content, err := os.ReadFile(config)
+	if err != nil {
+		return "", nil, err
+	}
+	doc, err := jsonc.Parse(content)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse %s: %w", config, err)
+	}
+	return config, doc, nil
+}
+
+// writeWorkspaceConfig writes the edited devcontainer.json back
+func writeWorkspaceConfig(config string, doc *jsonc.Document) error {
+	info, err := os.Stat(config)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(config, doc.Bytes(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", config, err)
+	}
+	return nil
+}
+
+// configFeatures returns the features of a parsed devcontainer.json in
+// document order. A version string is returned as the version option.
+func configFeatures(doc *jsonc.Document) ([]Feature, error) {
+	node, err := doc.Get("/features")
+	if errors.Is(err, jsonc.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if node.Kind != jsonc.Object {
+		return nil, fmt.Errorf("features must be an object, got %s", node.Kind)
+	}
+
+	var features []Feature
+	for _, member := range node.Members {
+		feature := Feature{ID: member.Key}
+		switch member.Value.Kind {
+		case jsonc.Object:
+			if err := member.Value.Decode(&feature.Options); err != nil {
+				return nil, fmt.Errorf("invalid options of feature '%s': %w", member.Key, err)
+			}
+		case jsonc.String:
+			feature.Options = map[string]any{"version": member.Value.String()}
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+// ListFeatures returns the features used by the devcontainer.json of
+// workspace
+func ListFeatures(workspace string, configName string) ([]Feature, error) {
+	_, doc, err := readWorkspaceConfig(workspace, configName)
+	if err != nil {
+		return nil, err
+	}
+	return configFeatures(doc)
+}
+
+// AddFeature adds a feature to the devcontainer.json of workspace, or merges
+// its options if the feature is already used. Unless validate is false, the
+// options of OCI features are checked against their devcontainer-feature.json.
+func AddFeature(workspace string, configName string, feature Feature, validate bool) error {
+	if feature.ID == "" {
+		return fmt.Errorf("feature id is required")
+	}
+	config, doc, err := readWorkspaceConfig(workspace, configName)
+	if err != nil {
+		return err
+	}
+
+	if validate && isOCIFeature(feature.ID) {
+		metadata, err := FetchFeatureMetadata(feature.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch feature '%s': %w", feature.ID, err)
+		}
+		if problems := metadata.checkOptions(feature.Options); len(problems) > 0 {
+			messages := make([]string, len(problems))
+			for i, problem := range problems {
+				messages[i] = problem.message
+			}
+			return fmt.Errorf("invalid options for feature '%s': %s", feature.ID, strings.Join(messages, "; "))
+		}
+	}
+
+	if err := setFeature(doc, feature.ID, feature.Options); err != nil {
+		return fmt.Errorf("failed to add feature '%s': %w", feature.ID, err)
+	}
+	return writeWorkspaceConfig(config, doc)
+}
+
+// RemoveFeature removes a feature from the devcontainer.json of workspace
+func RemoveFeature(workspace string, configName string, id string) error {
+	config, doc, err := readWorkspaceConfig(workspace, configName)
+	if err != nil {
+		return err
+	}
+	if err := doc.Delete("/features/" + jsonc.EscapePointer(id)); errors.Is(err, jsonc.ErrNotFound) {
+		return fmt.Errorf("feature '%s' is not used by %s", id, config)
+	} else if err != nil {
+		return fmt.Errorf("failed to remove feature '%s': %w", id, err)
+	}
+	return writeWorkspaceConfig(config, doc)
+}
@@ -0,0 +1,407 @@
+package devctmpl_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+const javaFeature = `{
+	"id": "java",
+	"version": "1.6.0",
+	"name": "Java",
+	"options": {
+		"version": {"type": "string", "proposals": ["latest", "21"], "default": "latest"},
+		"jdkDistro": {"type": "string", "enum": ["ms", "tem", "open"], "default": "ms"},
+		"installMaven": {"type": "boolean", "default": false}
+	}
+}`
+
+// startRegistry starts an in-process OCI registry and returns its host. If
+// requests is not nil, it counts the manifest requests.
+func startRegistry(t *testing.T, requests *atomic.Int32) string {
+	t.Helper()
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil && strings.Contains(r.URL.Path, "/manifests/") {
+			requests.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// pushFeature publishes a feature with the given devcontainer-feature.json
+// to reference and returns its manifest digest
+func pushFeature(t *testing.T, reference string, metadata string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := map[string]string{"./devcontainer-feature.json": metadata, "./install.sh": "#!/bin/sh\n"}
+	for _, file := range []string{"./devcontainer-feature.json", "./install.sh"} {
+		if err := tw.WriteHeader(&tar.Header{Name: file, Mode: 0644, Size: int64(len(files[file])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[file])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, static.NewLayer(buf.Bytes(), "application/vnd.devcontainers.layer.v1+tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("failed to push feature: %v", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digest.String()
+}
+
+func TestGenerateTemplateFeatures(t *testing.T) {
+	const config = `{
+	// Base image
+	"image": "debian:12",
+	"features": {
+		// Go toolchain
+		"ghcr.io/devcontainers/features/go:1": {
+			"version": "1.21"
+		},
+		"ghcr.io/devcontainers/features/git:1": "latest"
+	}
+}
+`
+	tests := []struct {
+		name     string
+		config   string
+		features []devctmpl.Feature
+		want     string
+	}{
+		{
+			name:   "add and merge",
+			config: config,
+			features: []devctmpl.Feature{
+				{ID: "ghcr.io/acme/features/certs:1"},
+				{ID: "ghcr.io/devcontainers/features/go:1", Options: map[string]any{"version": "1.22", "golangciLintVersion": "latest"}},
+				{ID: "ghcr.io/devcontainers/features/git:1", Options: map[string]any{"ppa": true}},
+			},
+			want: `{
+	// Base image
+	"image": "debian:12",
+	"features": {
+		// Go toolchain
+		"ghcr.io/devcontainers/features/go:1": {
+			"version": "1.22",
+			"golangciLintVersion": "latest"
+		},
+		"ghcr.io/devcontainers/features/git:1": {
+			"ppa": true,
+			"version": "latest"
+		},
+		"ghcr.io/acme/features/certs:1": {}
+	}
+}
+`,
+		},
+		{
+			name:   "no features object",
+			config: "{\n  // Base image\n  \"image\": \"debian:12\"\n}\n",
+			features: []devctmpl.Feature{
+				{ID: "ghcr.io/acme/features/certs:1", Options: map[string]any{"bundle": "corp"}},
+			},
+			want: "{\n  // Base image\n  \"image\": \"debian:12\",\n  \"features\": {\n    \"ghcr.io/acme/features/certs:1\": {\n      \"bundle\": \"corp\"\n    }\n  }\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "features", "version": "1.0.0", "name": "Features"}`)
+			writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), tt.config)
+
+			target := t.TempDir()
+			cfg := devctmpl.NewConfig()
+			cfg.Features = tt.features
+			cfg.Strict = true
+			if err := devctmpl.GenerateTemplateWithConfig(src, target, nil, cfg); err != nil {
+				t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+			}
+			got, err := os.ReadFile(filepath.Join(target, ".devcontainer/devcontainer.json"))
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceFeatures(t *testing.T) {
+	java := startRegistry(t, nil) + "/devcontainers/features/java:1"
+	pushFeature(t, java, javaFeature)
+
+	workspace := t.TempDir()
+	config := filepath.Join(workspace, ".devcontainer/devcontainer.json")
+	writeFile(t, config, `{
+	// Base image
+	"image": "debian:12",
+	"features": {
+		"ghcr.io/devcontainers/features/git:1": "latest" // git from source
+	}
+}
+`)
+
+	if err := devctmpl.AddFeature(workspace, "", devctmpl.Feature{ID: java, Options: map[string]any{"installMaven": true, "jdkDistro": "tem"}}, true); err != nil {
+		t.Fatalf("AddFeature() error = %v", err)
+	}
+	for options, want := range map[string]string{
+		`{"installMavn": true}`: "unknown option 'installMavn' (available options: installMaven, jdkDistro, version)",
+		`{"jdkDistro": "zulu"}`: "invalid value 'zulu' for option 'jdkDistro' (allowed values: ms, tem, open)",
+	} {
+		feature := devctmpl.Feature{ID: java}
+		if err := json.Unmarshal([]byte(options), &feature.Options); err != nil {
+			t.Fatal(err)
+		}
+		if err := devctmpl.AddFeature(workspace, "", feature, true); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("AddFeature(%s) error = %v, want %q", options, err, want)
+		}
+	}
+
+	features, err := devctmpl.ListFeatures(workspace, "")
+	if err != nil {
+		t.Fatalf("ListFeatures() error = %v", err)
+	}
+	wantFeatures := []devctmpl.Feature{
+		{ID: "ghcr.io/devcontainers/features/git:1", Options: map[string]any{"version": "latest"}},
+		{ID: java, Options: map[string]any{"installMaven": true, "jdkDistro": "tem"}},
+	}
+	if !reflect.DeepEqual(features, wantFeatures) {
+		t.Errorf("ListFeatures() = %v, want %v", features, wantFeatures)
+	}
+
+	if err := devctmpl.RemoveFeature(workspace, "", "ghcr.io/devcontainers/features/git:1"); err != nil {
+		t.Fatalf("RemoveFeature() error = %v", err)
+	}
+	if err := devctmpl.RemoveFeature(workspace, "", "ghcr.io/devcontainers/features/git:1"); err == nil {
+		t.Errorf("RemoveFeature() of a missing feature succeeded")
+	}
+	got, err := os.ReadFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+	// Base image
+	"image": "debian:12",
+	"features": {
+		"` + java + `": {
+			"installMaven": true,
+			"jdkDistro": "tem"
+		}
+	}
+}
+`
+	if string(got) != want {
+		t.Errorf("devcontainer.json =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCheckFeatures(t *testing.T) {
+	var requests atomic.Int32
+	host := startRegistry(t, &requests)
+	java := host + "/devcontainers/features/java:1"
+	pushFeature(t, java, javaFeature)
+	missing := host + "/devcontainers/features/jav:1"
+
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "java", "version": "1.0.0", "name": "Java",
+		"options": {"maven": {"type": "string", "description": "Maven option", "default": "installMaven"}}
+	}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{
+	"image": "debian:12",
+	"features": {
+		"`+java+`": {
+			"${templateOption:maven}": true,
+			"jdkDistro": "tem"
+		},
+		"./local-feature": {"anything": true}
+	}
+}
+`)
+
+	resolver := devctmpl.NewFeatureResolver()
+	cfg := devctmpl.NewConfig()
+	cfg.CheckFeatures = true
+	cfg.FeatureResolver = resolver
+	if err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), nil, cfg); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+
+	cfg.Features = []devctmpl.Feature{
+		{ID: java, Options: map[string]any{"jdkDistro": "zulu"}},
+		{ID: missing},
+	}
+	err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), map[string]string{"maven": "installMavn"}, cfg)
+	if err == nil {
+		t.Fatalf("GenerateTemplateWithConfig() with invalid features succeeded")
+	}
+	for _, want := range []string{
+		".devcontainer/devcontainer.json:5: error: feature '" + java + "': unknown option 'installMavn' (available options: installMaven, jdkDistro, version) [unknown-feature-option]",
+		".devcontainer/devcontainer.json:6: error: feature '" + java + "': invalid value 'zulu' for option 'jdkDistro' (allowed values: ms, tem, open) [invalid-feature-option]",
+		".devcontainer/devcontainer.json:9: error: feature '" + missing + "' could not be resolved",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "local-feature") {
+		t.Errorf("local feature was checked: %v", err)
+	}
+
+	// Every feature was fetched once
+	before := requests.Load()
+	if _, err := devctmpl.CheckFeatures(src, resolver); err != nil {
+		t.Fatalf("CheckFeatures() error = %v", err)
+	}
+	if after := requests.Load(); after != before {
+		t.Errorf("cached features were fetched again: %d manifest requests, want %d", after, before)
+	}
+}
+
+func TestFeatureResolver(t *testing.T) {
+	var requests atomic.Int32
+	host := startRegistry(t, &requests)
+	java := host + "/devcontainers/features/java:1"
+
+	// Failures are not cached
+	resolver := devctmpl.NewFeatureResolver()
+	if _, _, err := resolver.Resolve(java); err == nil {
+		t.Fatalf("Resolve() of an unpublished feature succeeded")
+	}
+	digest := pushFeature(t, java, javaFeature)
+	metadata, got, err := resolver.Resolve(java)
+	if err != nil {
+		t.Fatalf("Resolve() after publishing error = %v", err)
+	}
+	if metadata.ID != "java" || got != digest {
+		t.Errorf("Resolve() = %q, %s, want java, %s", metadata.ID, got, digest)
+	}
+
+	// Concurrent calls share a single fetch
+	before := requests.Load()
+	if _, _, err := devctmpl.NewFeatureResolver().Resolve(java); err != nil {
+		t.Fatal(err)
+	}
+	perFetch := requests.Load() - before
+
+	resolver = devctmpl.NewFeatureResolver()
+	before = requests.Load()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, got, err := resolver.Resolve(java); err != nil || got != digest {
+				t.Errorf("concurrent Resolve() = %s, %v, want %s", got, err, digest)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := requests.Load() - before; n != perFetch {
+		t.Errorf("concurrent calls made %d manifest requests, want %d", n, perFetch)
+	}
+}
+
+func TestLockFeatures(t *testing.T) {
+	host := startRegistry(t, nil)
+	java := host + "/devcontainers/features/java:1"
+	digest := pushFeature(t, java, javaFeature)
+	pinned := host + "/devcontainers/features/java@" + digest
+
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "lock", "version": "1.0.0", "name": "Lock"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{
+	"image": "debian:12",
+	"features": {
+		"`+java+`": {},
+		"./local-feature": {}
+	}
+}
+`)
+
+	workspace := t.TempDir()
+	cfg := devctmpl.NewConfig()
+	cfg.Lock = true
+	cfg.FeatureResolver = devctmpl.NewFeatureResolver()
+	if err := devctmpl.GenerateTemplateWithConfig(src, workspace, nil, cfg); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(workspace, ".devcontainer/devcontainer-lock.json"))
+	if err != nil {
+		t.Fatalf("lockfile not written: %v", err)
+	}
+	want := `{
+  "features": {
+    "` + java + `": {
+      "version": "1.6.0",
+      "resolved": "` + pinned + `",
+      "integrity": "` + digest + `"
+    }
+  }
+}
+`
+	if string(got) != want {
+		t.Errorf("devcontainer-lock.json =\n%s\nwant\n%s", got, want)
+	}
+
+	// A new release is picked up by updating the lockfile only
+	newDigest := pushFeature(t, java, strings.Replace(javaFeature, "1.6.0", "1.7.0", 1))
+	lock, err := devctmpl.LockFeatures(workspace, "", false, devctmpl.NewFeatureResolver())
+	if err != nil {
+		t.Fatalf("LockFeatures() error = %v", err)
+	}
+	if locked := lock.Features[java]; locked.Integrity != digest {
+		t.Errorf("LockFeatures() without update locked %s, want %s", locked.Integrity, digest)
+	}
+	lock, err = devctmpl.LockFeatures(workspace, "", true, devctmpl.NewFeatureResolver())
+	if err != nil {
+		t.Fatalf("LockFeatures() error = %v", err)
+	}
+	if locked := lock.Features[java]; locked.Integrity != newDigest || locked.Version != "1.7.0" {
+		t.Errorf("LockFeatures() with update locked %+v, want version 1.7.0 at %s", locked, newDigest)
+	}
+	if len(lock.Features) != 1 {
+		t.Errorf("lockfile features = %v, want only %s", lock.Features, java)
+	}
+}
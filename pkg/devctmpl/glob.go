@@ -0,0 +1,121 @@
+package devctmpl
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// pathPattern is a compiled glob pattern for slash separated paths relative
+// to the template root
+type pathPattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// pathMatcher matches paths against an ordered list of glob patterns.
+//
+// Patterns support '*', '?' and character classes within a path segment,
+// '**' for any number of segments, a trailing '/' to match directories only
+// and a leading '!' to negate a pattern. As in .gitignore the last matching
+// pattern wins, and a path matches if the path itself or one of its parent
+// directories matches, so "dir", "dir/" and "dir/*" all cover a directory.
+type pathMatcher struct {
+	patterns []pathPattern
+}
+
+// compilePathPatterns compiles patterns into a matcher, reporting invalid
+// patterns as errors
+func compilePathPatterns(patterns []string) (*pathMatcher, error) {
+	m := &pathMatcher{patterns: make([]pathPattern, 0, len(patterns))}
+	for _, raw := range patterns {
+		p, err := compilePathPattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+func compilePathPattern(raw string) (pathPattern, error) {
+	var p pathPattern
+	pattern := raw
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "./"), "/")
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return p, fmt.Errorf("invalid pattern '%s': empty path", raw)
+	}
+
+	p.segments = strings.Split(pattern, "/")
+	for _, segment := range p.segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return p, fmt.Errorf("invalid pattern '%s': unexpected path segment '%s'", raw, segment)
+		}
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return p, fmt.Errorf("invalid pattern '%s': %w", raw, err)
+		}
+	}
+	return p, nil
+}
+
+// match reports whether the slash separated path name is matched
+func (m *pathMatcher) match(name string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	parts := strings.Split(name, "/")
+	matched := false
+	for _, p := range m.patterns {
+		if p.match(parts, isDir) {
+			matched = !p.negate
+		}
+	}
+	return matched
+}
+
+// match reports whether the pattern matches the path or one of its parents
+func (p pathPattern) match(parts []string, isDir bool) bool {
+	for i := len(parts); i > 0; i-- {
+		if p.dirOnly && i == len(parts) && !isDir {
+			continue
+		}
+		if matchSegments(p.segments, parts[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// '**' matches zero or more segments
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,124 @@
+package devctmpl_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestOmitPathsGlobs(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "globs", "version": "1.0.0", "name": "Globs",
+		"optionalPaths": ["docs/", "should_copy/", "x*.txt"]
+	}`)
+	for _, name := range []string{
+		".devcontainer/devcontainer.json",
+		".devcontainer/Dockerfile",
+		".devcontainer/notes.md",
+		"docs/a.md",
+		"docs/b.txt",
+		"docs/deep/c.md",
+		"should_copy/README.md",
+		"should_copy/sub_folder/README.md",
+		"x1.txt",
+		"x2.txt",
+		"xa.txt",
+	} {
+		writeFile(t, filepath.Join(src, name), "content")
+	}
+
+	tests := []struct {
+		name      string
+		omitPaths []string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "double star",
+			omitPaths: []string{"should_copy/**"},
+			want:      []string{".devcontainer/Dockerfile", ".devcontainer/devcontainer.json", ".devcontainer/notes.md", "docs/a.md", "docs/b.txt", "docs/deep/c.md", "x1.txt", "x2.txt", "xa.txt"},
+		},
+		{
+			name:      "double star across directories omits optional files only",
+			omitPaths: []string{"**/*.md"},
+			want:      []string{".devcontainer/Dockerfile", ".devcontainer/devcontainer.json", ".devcontainer/notes.md", "docs/b.txt", "x1.txt", "x2.txt", "xa.txt"},
+		},
+		{
+			name:      "question mark and character class",
+			omitPaths: []string{"x?.txt", "!x[a-z].txt"},
+			want:      []string{".devcontainer/Dockerfile", ".devcontainer/devcontainer.json", ".devcontainer/notes.md", "docs/a.md", "docs/b.txt", "docs/deep/c.md", "should_copy/README.md", "should_copy/sub_folder/README.md", "xa.txt"},
+		},
+		{
+			name:      "directory suffix and negation",
+			omitPaths: []string{"docs/", "should_copy/*", "!should_copy/README.md"},
+			want:      []string{".devcontainer/Dockerfile", ".devcontainer/devcontainer.json", ".devcontainer/notes.md", "should_copy/README.md", "x1.txt", "x2.txt", "xa.txt"},
+		},
+		{
+			name:      "required path",
+			omitPaths: []string{".devcontainer/devcontainer.json"},
+			wantErr:   true,
+		},
+		{
+			name:      "pattern matching no optional path",
+			omitPaths: []string{"docs/", ".devcontainer/*.md"},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid pattern",
+			omitPaths: []string{"docs/[a-"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := t.TempDir()
+			config := devctmpl.NewConfig()
+			config.OmitPaths = tt.omitPaths
+			err := devctmpl.GenerateTemplateWithConfig(src, target, nil, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateTemplateWithConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := listFiles(t, target); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got files %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// listFiles returns the sorted slash separated paths of all files in dir,
+// except for the template state
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == devctmpl.StateDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+	sort.Strings(files)
+	return files
+}
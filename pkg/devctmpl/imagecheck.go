@@ -0,0 +1,325 @@
+package devctmpl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// ImageRules are the checks run by CheckImages
+var ImageRules = []Rule{
+	{ID: "image-reference", Description: "Images of devcontainer.json files and Dockerfile FROM lines are valid references"},
+	{ID: "image-exists", Description: "Images are published in their registry"},
+}
+
+// maxTagSuggestions is the number of similar tags suggested for a missing tag
+const maxTagSuggestions = 3
+
+// imageUse is an image referenced by a file in the configuration
+type imageUse struct {
+	reference string
+	file      string
+	line      int
+}
+
+// CheckImages checks that the image of the devcontainer.json files in dir
+// and the FROM lines of its Dockerfiles are valid image references. If
+// remote is set, the manifest of every image is requested from its registry
+// and missing tags are reported with similar tags of the repository. File
+// paths in issues are joined with dir.
+func CheckImages(dir string, remote bool) ([]Issue, error) {
+	issues, err := checkImages(dir, remote)
+	for i := range issues {
+		issues[i].File = filepath.Join(dir, filepath.FromSlash(issues[i].File))
+	}
+	return issues, err
+}
+
+// checkImages is CheckImages with file paths relative to dir
+func checkImages(dir string, remote bool) ([]Issue, error) {
+	images, err := findImages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	checked := make(map[string]*Issue)
+	for _, image := range images {
+		ref, err := name.ParseReference(image.reference)
+		if err != nil {
+			issues = append(issues, Issue{
+				Rule:     "image-reference",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("invalid image reference '%s': %v", image.reference, err),
+				File:     image.file,
+				Line:     image.line,
+			})
+			continue
+		}
+		if !remote {
+			continue
+		}
+		problem, ok := checked[ref.Name()]
+		if !ok {
+			problem = checkImageExists(ref)
+			checked[ref.Name()] = problem
+		}
+		if problem != nil {
+			issue := *problem
+			issue.File, issue.Line = image.file, image.line
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+// checkImageExists requests the manifest of ref and returns an issue if it
+// is missing or can't be requested
+func checkImageExists(ref name.Reference) *Issue {
+	_, err := remote.Head(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err == nil {
+		return nil
+	}
+	var terr *transport.Error
+	if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+		return &Issue{
+			Rule:     "image-exists",
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("image '%s' could not be checked: %v", ref, err),
+		}
+	}
+
+	message := fmt.Sprintf("image '%s' does not exist", ref)
+	if tag, ok := ref.(name.Tag); ok {
+		tags, err := remote.List(ref.Context(), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		if err == nil && len(tags) > 0 {
+			message = fmt.Sprintf("image '%s' does not exist, tag '%s' not found (similar tags: %s)",
+				ref, tag.TagStr(), strings.Join(similarTags(tag.TagStr(), tags), ", "))
+		}
+	}
+	return &Issue{Rule: "image-exists", Severity: SeverityError, Message: message}
+}
+
+// similarTags returns the tags closest to tag by edit distance
+func similarTags(tag string, tags []string) []string {
+	distances := make(map[string]int, len(tags))
+	for _, t := range tags {
+		distances[t] = editDistance(tag, t)
+	}
+	sorted := append([]string(nil), tags...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if distances[sorted[i]] != distances[sorted[j]] {
+			return distances[sorted[i]] < distances[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	if len(sorted) > maxTagSuggestions {
+		sorted = sorted[:maxTagSuggestions]
+	}
+	return sorted
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// findImages returns the images of the devcontainer.json files in dir and
+// of the FROM lines of the Dockerfiles in dir. References using variables
+// that can't be resolved are left out.
+func findImages(dir string) ([]imageUse, error) {
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []imageUse
+	dockerfiles := make(map[string]bool)
+	for _, config := range configs {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(config.Path)))
+		if err != nil {
+			return nil, err
+		}
+		doc, err := jsonc.Parse(content)
+		if err != nil || doc.Root.Kind != jsonc.Object {
+			// Reported by CheckConfigs
+			continue
+		}
+		if node, image := stringMember(doc, "image"); node != nil && !strings.Contains(image, "${") {
+			line, _ := doc.Position(node)
+			images = append(images, imageUse{reference: image, file: config.Path, line: line})
+		}
+		for _, pointer := range []string{"/build/dockerfile", "/dockerFile"} {
+			var dockerfile string
+			if node, err := doc.Get(pointer); err != nil || node.Decode(&dockerfile) != nil {
+				continue
+			}
+			file := path.Join(path.Dir(config.Path), dockerfile)
+			if !strings.HasPrefix(file, "../") {
+				dockerfiles[file] = true
+			}
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isDockerfile(d.Name()) {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return err
+			}
+			dockerfiles[filepath.ToSlash(rel)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(dockerfiles))
+	for file := range dockerfiles {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range dockerfileImages(content) {
+			image.file = file
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// isDockerfile reports whether a file name is a Dockerfile by convention:
+// Dockerfile, Dockerfile.<suffix> or <prefix>.Dockerfile
+func isDockerfile(name string) bool {
+	lower := strings.ToLower(name)
+	return lower == "dockerfile" || strings.HasPrefix(lower, "dockerfile.") || strings.HasSuffix(lower, ".dockerfile")
+}
+
+// dockerfileImages returns the images of the FROM lines of a Dockerfile.
+// Variables are expanded with the defaults of the ARG lines before the
+// first FROM; scratch and earlier build stages are left out.
+func dockerfileImages(content []byte) []imageUse {
+	var images []imageUse
+	args := make(map[string]string)
+	stages := make(map[string]bool)
+	seenFrom := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNum, start := 0, 0
+	instruction := ""
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if instruction == "" {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			start = lineNum
+		}
+		if strings.HasSuffix(line, "\\") {
+			instruction += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		instruction += line
+		fields := strings.Fields(instruction)
+		instruction = ""
+
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			if seenFrom {
+				continue
+			}
+			for _, arg := range fields[1:] {
+				if key, value, ok := strings.Cut(arg, "="); ok {
+					args[key] = strings.Trim(value, `"'`)
+				}
+			}
+		case "FROM":
+			seenFrom = true
+			var operands []string
+			for _, field := range fields[1:] {
+				if !strings.HasPrefix(field, "--") {
+					operands = append(operands, field)
+				}
+			}
+			if len(operands) == 0 {
+				continue
+			}
+			image, ok := expandArgs(operands[0], args)
+			known := !ok || image == "scratch" || stages[strings.ToLower(image)]
+			if len(operands) >= 3 && strings.EqualFold(operands[1], "AS") {
+				stages[strings.ToLower(operands[2])] = true
+			}
+			if known {
+				continue
+			}
+			images = append(images, imageUse{reference: image, line: start})
+		}
+	}
+	return images
+}
+
+// expandArgs replaces $NAME, ${NAME} and ${NAME:-default} with args and
+// reports whether every variable was set
+func expandArgs(s string, args map[string]string) (string, bool) {
+	ok := true
+	expanded := os.Expand(s, func(key string) string {
+		key, fallback, hasDefault := strings.Cut(key, ":-")
+		if value, set := args[key]; set && value != "" {
+			return value
+		}
+		if hasDefault {
+			return fallback
+		}
+		ok = false
+		return ""
+	})
+	return expanded, ok
+}
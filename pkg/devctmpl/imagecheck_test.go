@@ -0,0 +1,89 @@
+package devctmpl_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestCheckImages(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".devcontainer", "devcontainer.json"), `{
+	"name": "Go",
+	"image": "mcr.microsoft.com/devcontainers/go:1-BAD TAG"
+}`)
+	writeFile(t, filepath.Join(dir, ".devcontainer", "base", "devcontainer.json"), `{"build": {"dockerfile": "../build/app.dockerfile"}}`)
+	writeFile(t, filepath.Join(dir, ".devcontainer", "build", "app.dockerfile"), `# syntax=docker/dockerfile:1
+ARG VARIANT=1.22
+FROM --platform=$BUILDPLATFORM golang:${VARIANT} AS build
+FROM build
+FROM ${REGISTRY}/app:1
+FROM scratch AS \
+	final
+FROM alpine:${ALPINE:-3}
+FROM Alpine:3
+`)
+
+	issues, err := devctmpl.CheckImages(dir, false)
+	if err != nil {
+		t.Fatalf("CheckImages() error = %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, ".devcontainer", "devcontainer.json") + ":3: error: invalid image reference 'mcr.microsoft.com/devcontainers/go:1-BAD TAG'",
+		filepath.Join(dir, ".devcontainer", "build", "app.dockerfile") + ":9: error: invalid image reference 'Alpine:3'",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("CheckImages() = %v, want %d issues", issues, len(want))
+	}
+	for i, w := range want {
+		if got := issues[i].String(); !strings.HasPrefix(got, w) {
+			t.Errorf("issue %d = %q, want prefix %q", i, got, w)
+		}
+	}
+}
+
+func TestCheckImagesRemote(t *testing.T) {
+	host := startRegistry(t, nil)
+	for _, tag := range []string{"1-21-bullseye", "1-17-bullseye", "1-21-bookworm", "2"} {
+		pushFeature(t, host+"/java:"+tag, javaFeature)
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".devcontainer", "devcontainer.json"), `{
+	"image": "`+host+`/java:1-21-bullsey",
+	"build": {"dockerfile": "Dockerfile"}
+}`)
+	writeFile(t, filepath.Join(dir, ".devcontainer", "Dockerfile"), "FROM "+host+"/java:1-17-bullseye\nFROM "+host+"/missing:1\n")
+
+	issues, err := devctmpl.CheckImages(dir, true)
+	if err != nil {
+		t.Fatalf("CheckImages() error = %v", err)
+	}
+	want := []string{
+		":2: error: image '" + host + "/java:1-21-bullsey' does not exist, tag '1-21-bullsey' not found (similar tags: 1-21-bullseye, 1-17-bullseye, 1-21-bookworm) [image-exists]",
+		":2: error: image '" + host + "/missing:1' does not exist [image-exists]",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("CheckImages() = %v, want %d issues", issues, len(want))
+	}
+	for i, w := range want {
+		if got := issues[i].String(); !strings.HasSuffix(got, w) {
+			t.Errorf("issue %d = %q, want suffix %q", i, got, w)
+		}
+	}
+
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "java", "version": "1.0.0", "name": "Java", "options": {"variant": {"type": "string", "description": "Variant"}}}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), `{"image": "`+host+`/java:1-${templateOption:variant}"}`)
+	config := devctmpl.NewConfig()
+	config.CheckImages = true
+	if err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), map[string]string{"variant": "21-bookworm"}, config); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+	err = devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), map[string]string{"variant": "21-bookwrm"}, config)
+	if err == nil || !strings.Contains(err.Error(), "similar tags: 1-21-bookworm") {
+		t.Errorf("GenerateTemplateWithConfig() error = %v, want missing image error", err)
+	}
+}
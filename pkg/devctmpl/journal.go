@@ -0,0 +1,122 @@
+package devctmpl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// Directories in the state directory holding the workspace files as they were before
+// the template was applied, and as the template wrote them
+const (
+	backupDirName  = "backup"
+	appliedDirName = "applied"
+)
+
+// AppliedFile records a workspace file written by applying or upgrading a
+// template
+type AppliedFile struct {
+	// Created is set if the file did not exist before. Otherwise its
+	// previous content is kept in the backup directory of the state.
+	Created bool `json:"created,omitempty"`
+	// Hash is the hash of the content written, or empty if the file was
+	// removed by an upgrade
+	Hash string `json:"hash,omitempty"`
+}
+
+// journal records the changes made to a workspace so they can be reverted.
+// Files are recorded the first time they are written, so a revert restores
+// the workspace as it was before the first apply. All changes, including
+// the backups, are made through the transaction.
+type journal struct {
+	tx *transaction
+	// stateDir is the slash separated state directory in the workspace
+	stateDir string
+	applied  map[string]AppliedFile
+	dirs     []string
+}
+
+// openJournal returns a journal for the workspace of tx, keeping its
+// records in stateDir, that continues the records of an earlier apply, if any
+func openJournal(tx *transaction, stateDir string) (*journal, error) {
+	j := &journal{tx: tx, stateDir: stateDir, applied: make(map[string]AppliedFile)}
+	data, err := os.ReadFile(tx.path(path.Join(stateDir, stateFileName)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template state: %w", err)
+	}
+	state, err := parseState(data)
+	if err != nil {
+		return nil, err
+	}
+	for rel, file := range state.Applied {
+		j.applied[rel] = file
+	}
+	j.dirs = state.Dirs
+	return j, nil
+}
+
+// record saves the state of the workspace file rel before it is changed
+func (j *journal) record(rel string) error {
+	if _, ok := j.applied[rel]; ok {
+		return nil
+	}
+	src := j.tx.path(rel)
+	if _, err := os.Lstat(src); errors.Is(err, fs.ErrNotExist) {
+		j.applied[rel] = AppliedFile{Created: true}
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := j.tx.copyFile(src, path.Join(j.stateDir, backupDirName, rel)); err != nil {
+		return fmt.Errorf("failed to back up '%s': %w", rel, err)
+	}
+	j.applied[rel] = AppliedFile{}
+	return nil
+}
+
+// written records the content the template wrote to rel, or its removal if
+// data is nil
+func (j *journal) written(rel string, data []byte) error {
+	file := j.applied[rel]
+	applied := path.Join(j.stateDir, appliedDirName, rel)
+	if data == nil {
+		file.Hash = ""
+		j.applied[rel] = file
+		return j.tx.remove(applied)
+	}
+
+	file.Hash = hashBytes(data)
+	j.applied[rel] = file
+	return j.tx.writeFile(applied, data, 0644)
+}
+
+// mkdirAll creates the directory rel and its parents in the workspace,
+// recording those that did not exist
+func (j *journal) mkdirAll(rel string) error {
+	created, err := j.tx.mkdirAll(rel)
+	if err != nil {
+		return err
+	}
+	j.dirs = append(j.dirs, created...)
+	return nil
+}
+
+// writeState writes state with the records of the journal
+func (j *journal) writeState(state *State) error {
+	state.Applied, state.Dirs = j.applied, j.dirs
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := j.tx.writeFile(path.Join(j.stateDir, stateFileName), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write template state: %w", err)
+	}
+	return nil
+}
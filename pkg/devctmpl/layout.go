@@ -0,0 +1,330 @@
+package devctmpl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// Layout is the location of the devcontainer.json in the output
+type Layout string
+
+const (
+	// LayoutKeep keeps the layout of the template
+	LayoutKeep Layout = ""
+	// LayoutRootFile writes the configuration to .devcontainer.json
+	LayoutRootFile Layout = "root"
+	// LayoutFolder writes the configuration to .devcontainer/devcontainer.json
+	LayoutFolder Layout = "folder"
+)
+
+// path returns the location of the configuration file for the layout
+func (l Layout) path() (string, error) {
+	switch l {
+	case LayoutRootFile:
+		return ".devcontainer.json", nil
+	case LayoutFolder:
+		return ".devcontainer/devcontainer.json", nil
+	default:
+		return "", fmt.Errorf("unknown layout '%s' (supported layouts: %s, %s)", l, LayoutRootFile, LayoutFolder)
+	}
+}
+
+// configPathProperties are the devcontainer.json properties holding paths
+// relative to the configuration file
+var configPathProperties = []string{"build.dockerfile", "build.context", "dockerFile", "context", "dockerComposeFile"}
+
+// dockerfileContext pairs the JSON pointers of a Dockerfile property and the
+// build context it is resolved in
+type dockerfileContext struct {
+	dockerfile string
+	context    string
+}
+
+var dockerfileContexts = []dockerfileContext{
+	{dockerfile: "/build/dockerfile", context: "/build/context"},
+	{dockerfile: "/dockerFile", context: "/context"},
+}
+
+// selectDevContainerConfig narrows the rendered template in dir down to the
+// named sub-configuration, if any, and converts it to the requested layout
+func selectDevContainerConfig(dir string, configName string, layout Layout) error {
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return err
+	}
+
+	var selected *devContainerConfig
+	if configName != "" {
+		names := make([]string, 0, len(configs))
+		for i, config := range configs {
+			if config.Name == configName {
+				selected = &configs[i]
+			} else if config.Name != "" {
+				names = append(names, config.Name)
+			}
+		}
+		if selected == nil {
+			return fmt.Errorf("configuration '%s' not found in template (available configurations: %v)", configName, names)
+		}
+
+		// Drop every other configuration
+		for _, config := range configs {
+			if config == *selected {
+				continue
+			}
+			remove := filepath.Join(dir, filepath.FromSlash(config.Path))
+			if config.Name != "" {
+				remove = filepath.Dir(remove)
+			}
+			if err := os.RemoveAll(remove); err != nil {
+				return fmt.Errorf("failed to remove configuration '%s': %w", config.Path, err)
+			}
+		}
+	} else if len(configs) == 1 {
+		selected = &configs[0]
+	}
+
+	if layout == LayoutKeep {
+		return nil
+	}
+	target, err := layout.path()
+	if err != nil {
+		return err
+	}
+	if selected == nil {
+		return fmt.Errorf("template has %d configurations, select one to convert its layout", len(configs))
+	}
+	return moveDevContainerConfig(dir, selected.Path, target)
+}
+
+// moveDevContainerConfig moves a configuration file within dir, rewriting the
+// relative paths it contains so they still resolve
+func moveDevContainerConfig(dir string, from string, to string) error {
+	if from == to {
+		return nil
+	}
+
+	src := filepath.Join(dir, filepath.FromSlash(from))
+	dst := filepath.Join(dir, filepath.FromSlash(to))
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("can't move %s to %s: file already exists", from, to)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	content, err = rewriteConfigPaths(content, path.Dir(from), path.Dir(to), "", "")
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", from, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, content, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return err
+	}
+
+	// Remove the folder of a named configuration if nothing else is left
+	if srcDir := filepath.Dir(src); srcDir != dir {
+		if entries, err := os.ReadDir(srcDir); err == nil && len(entries) == 0 {
+			return os.Remove(srcDir)
+		}
+	}
+	return nil
+}
+
+// rewriteConfigPaths rewrites the relative paths of a devcontainer.json
+// moved from fromDir to toDir. Paths into movedFrom, if set, are resolved in
+// movedTo, where its content was moved along with the configuration. A build
+// context that defaulted to the folder of the configuration is made explicit.
+func rewriteConfigPaths(content []byte, fromDir string, toDir string, movedFrom string, movedTo string) ([]byte, error) {
+	doc, err := jsonc.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// The context defaults to the folder of the configuration
+	var missing []dockerfileContext
+	for _, p := range dockerfileContexts {
+		_, errDockerfile := doc.Get(p.dockerfile)
+		_, errContext := doc.Get(p.context)
+		if errDockerfile == nil && errContext != nil {
+			missing = append(missing, p)
+		}
+	}
+
+	err = replaceConfigPaths(doc, func(value string) (string, bool) {
+		return relocatePath(value, fromDir, toDir, movedFrom, movedTo)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range missing {
+		if rel, ok := relocatePath(".", fromDir, toDir, movedFrom, movedTo); ok {
+			if err := doc.SetBefore(p.context, rel, path.Base(p.dockerfile)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return doc.Bytes(), nil
+}
+
+// replaceConfigPaths replaces the string values of the configPathProperties
+// of a devcontainer.json, and the elements of those holding arrays, with the
+// result of replace if it reports a change
+func replaceConfigPaths(doc *jsonc.Document, replace func(value string) (string, bool)) error {
+	for _, property := range configPathProperties {
+		pointer := "/" + strings.ReplaceAll(property, ".", "/")
+		node, err := doc.Get(pointer)
+		if err != nil {
+			continue
+		}
+		pointers := []string{pointer}
+		if node.Kind == jsonc.Array {
+			pointers = nil
+			for i := range node.Elements {
+				pointers = append(pointers, fmt.Sprintf("%s/%d", pointer, i))
+			}
+		}
+		for _, p := range pointers {
+			value, err := doc.Get(p)
+			if err != nil || value.Kind != jsonc.String {
+				continue
+			}
+			if replaced, ok := replace(value.String()); ok {
+				if err := doc.Set(p, replaced); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// relocatePath returns value, a path relative to fromDir, relative to toDir.
+// A path into movedFrom is resolved in movedTo. Absolute paths and paths
+// using variables are left unchanged.
+func relocatePath(value string, fromDir string, toDir string, movedFrom string, movedTo string) (string, bool) {
+	if value == "" || strings.Contains(value, "${") || path.IsAbs(value) || filepath.IsAbs(value) {
+		return "", false
+	}
+	target := path.Join(fromDir, value)
+	if movedFrom != "" {
+		target, _ = movedPath(target, movedFrom, movedTo)
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(toDir), filepath.FromSlash(target))
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == value {
+		return "", false
+	}
+	return rel, true
+}
+
+// checkConfigName checks that name can be used as the folder of a named
+// sub-configuration
+func checkConfigName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid configuration name '%s'", name)
+	}
+	return nil
+}
+
+// relocateDevContainerConfig moves the configuration of the rendered template
+// in dir, along with the other files of its folder, to the named
+// sub-configuration .devcontainer/<name>/. Relative paths in the
+// configuration and its Docker Compose files are rewritten so they still
+// resolve.
+func relocateDevContainerConfig(dir string, name string) error {
+	if err := checkConfigName(name); err != nil {
+		return err
+	}
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return err
+	}
+	if len(configs) != 1 {
+		return fmt.Errorf("template has %d configurations, select one to apply it as configuration '%s'", len(configs), name)
+	}
+
+	toDir := ".devcontainer/" + name
+	to := toDir + "/devcontainer.json"
+	from := configs[0].Path
+	if from == to {
+		return nil
+	}
+	if from == ".devcontainer.json" {
+		return moveDevContainerConfig(dir, from, to)
+	}
+
+	// Move the folder of the configuration
+	fromDir := path.Dir(from)
+	src := filepath.Join(dir, filepath.FromSlash(fromDir))
+	dst := filepath.Join(dir, filepath.FromSlash(toDir))
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(from)))
+	if err != nil {
+		return err
+	}
+	doc, err := jsonc.Parse(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", from, err)
+	}
+	if err := relocateComposeFiles(dir, fromDir, composeFiles(doc), fromDir, toDir); err != nil {
+		return err
+	}
+	content, err = rewriteConfigPaths(content, fromDir, toDir, fromDir, toDir)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", from, err)
+	}
+
+	if fromDir == ".devcontainer" {
+		// The destination is inside the folder, move its entries one by one
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Name() == name {
+				return fmt.Errorf("can't move %s to %s: %s/%s already exists", fromDir, toDir, fromDir, name)
+			}
+		}
+		if err := os.Mkdir(dst, 0755); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := os.Rename(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+	} else {
+		if _, err := os.Stat(dst); err == nil {
+			return fmt.Errorf("can't move %s to %s: folder already exists", fromDir, toDir)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "devcontainer.json"))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dst, "devcontainer.json"), content, info.Mode().Perm())
+}
@@ -0,0 +1,243 @@
+package devctmpl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestGenerateTemplateLayouts(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		configName string
+		layout     devctmpl.Layout
+		asConfig   string
+		existing   map[string]string
+		want       map[string]string
+		wantAbsent []string
+		wantErr    bool
+	}{
+		{
+			name: "root file",
+			files: map[string]string{
+				".devcontainer.json": `{"image": "debian"}`,
+			},
+			want: map[string]string{".devcontainer.json": `{"image": "debian"}`},
+		},
+		{
+			name: "named configuration",
+			files: map[string]string{
+				".devcontainer/devcontainer.json":      `{"image": "debian"}`,
+				".devcontainer/java/devcontainer.json": `{"image": "java"}`,
+				".devcontainer/go/devcontainer.json":   `{"image": "go"}`,
+				".devcontainer/shared.sh":              `echo`,
+			},
+			configName: "java",
+			want: map[string]string{
+				".devcontainer/java/devcontainer.json": `{"image": "java"}`,
+				".devcontainer/shared.sh":              `echo`,
+			},
+			wantAbsent: []string{".devcontainer/devcontainer.json", ".devcontainer/go"},
+		},
+		{
+			name: "unknown configuration",
+			files: map[string]string{
+				".devcontainer/java/devcontainer.json": `{"image": "java"}`,
+			},
+			configName: "go",
+			wantErr:    true,
+		},
+		{
+			name: "named configuration to folder layout",
+			files: map[string]string{
+				".devcontainer/java/devcontainer.json": "{\n\t\"build\": {\n\t\t\"dockerfile\": \"Dockerfile\"\n\t}\n}",
+				".devcontainer/java/Dockerfile":        "FROM java",
+			},
+			configName: "java",
+			layout:     devctmpl.LayoutFolder,
+			want: map[string]string{
+				".devcontainer/devcontainer.json": "{\n\t\"build\": {\n\t\t\"context\": \"java\",\n\t\t\"dockerfile\": \"java/Dockerfile\"\n\t}\n}",
+				".devcontainer/java/Dockerfile":   "FROM java",
+			},
+			wantAbsent: []string{".devcontainer/java/devcontainer.json"},
+		},
+		{
+			name: "folder to root file layout",
+			files: map[string]string{
+				// A comment with "dockerfile": "x"
+				".devcontainer/devcontainer.json": "// \"dockerfile\": \"x\"\n{\"build\": {\"context\": \"..\", \"dockerfile\": \"Dockerfile\"}, \"dockerComposeFile\": [\"compose.yml\", \"${localEnv:X}\"]}",
+			},
+			layout: devctmpl.LayoutRootFile,
+			want: map[string]string{
+				".devcontainer.json": "// \"dockerfile\": \"x\"\n{\"build\": {\"context\": \".\", \"dockerfile\": \".devcontainer/Dockerfile\"}, \"dockerComposeFile\": [\".devcontainer/compose.yml\", \"${localEnv:X}\"]}",
+			},
+			wantAbsent: []string{".devcontainer/devcontainer.json"},
+		},
+		{
+			name: "ambiguous layout conversion",
+			files: map[string]string{
+				".devcontainer.json":              `{}`,
+				".devcontainer/devcontainer.json": `{}`,
+			},
+			layout:  devctmpl.LayoutFolder,
+			wantErr: true,
+		},
+		{
+			name: "folder as named configuration",
+			files: map[string]string{
+				".devcontainer/devcontainer.json":      "{\n\t\"build\": {\n\t\t\"dockerfile\": \"Dockerfile\",\n\t\t\"context\": \"..\"\n\t},\n\t\"dockerComposeFile\": \"compose.yml\"\n}",
+				".devcontainer/Dockerfile":             "FROM java",
+				".devcontainer/compose.yml":            "services: {}",
+				".devcontainer/scripts/post-create.sh": "echo",
+			},
+			asConfig: "java",
+			existing: map[string]string{".devcontainer/backend/devcontainer.json": `{"image": "go"}`},
+			want: map[string]string{
+				".devcontainer/java/devcontainer.json":      "{\n\t\"build\": {\n\t\t\"dockerfile\": \"Dockerfile\",\n\t\t\"context\": \"../..\"\n\t},\n\t\"dockerComposeFile\": \"compose.yml\"\n}",
+				".devcontainer/java/Dockerfile":             "FROM java",
+				".devcontainer/java/compose.yml":            "services: {}",
+				".devcontainer/java/scripts/post-create.sh": "echo",
+				".devcontainer/backend/devcontainer.json":   `{"image": "go"}`,
+			},
+			wantAbsent: []string{".devcontainer/devcontainer.json", ".devcontainer/Dockerfile"},
+		},
+		{
+			name: "docker compose as named configuration",
+			files: map[string]string{
+				".devcontainer/devcontainer.json": `{"dockerComposeFile": ["compose.yml", "../compose.override.yml"], "service": "app"}`,
+				".devcontainer/compose.yml": `services:
+  app:
+    build:
+      context: ..
+      dockerfile: .devcontainer/Dockerfile
+    env_file: "./app.env"
+    volumes:
+      # The workspace
+      - ../..:/workspaces:cached
+      - cache:/cache
+      - type: bind
+        source: ./scripts
+        target: /scripts
+volumes:
+  cache:`,
+				"compose.override.yml": "services:\n  app:\n    volumes:\n      - '../data:/data'",
+			},
+			asConfig: "java",
+			want: map[string]string{
+				".devcontainer/java/devcontainer.json": `{"dockerComposeFile": ["compose.yml", "../../compose.override.yml"], "service": "app"}`,
+				".devcontainer/java/compose.yml": `services:
+  app:
+    build:
+      context: ../..
+      dockerfile: .devcontainer/Dockerfile
+    env_file: "app.env"
+    volumes:
+      # The workspace
+      - ../../..:/workspaces:cached
+      - cache:/cache
+      - type: bind
+        source: scripts
+        target: /scripts
+volumes:
+  cache:`,
+				"compose.override.yml": "services:\n  app:\n    volumes:\n      - '../../data:/data'",
+			},
+		},
+		{
+			name: "root file as named configuration",
+			files: map[string]string{
+				".devcontainer.json": `{"build": {"dockerfile": "Dockerfile"}}`,
+				"Dockerfile":         "FROM java",
+			},
+			asConfig: "java",
+			want: map[string]string{
+				".devcontainer/java/devcontainer.json": `{"build": {"context": "../..", "dockerfile": "../../Dockerfile"}}`,
+				"Dockerfile":                           "FROM java",
+			},
+			wantAbsent: []string{".devcontainer.json"},
+		},
+		{
+			name: "named configuration renamed",
+			files: map[string]string{
+				".devcontainer/jdk/devcontainer.json": `{"build": {"dockerfile": "Dockerfile", "context": "../shared"}}`,
+				".devcontainer/jdk/Dockerfile":        "FROM java",
+				".devcontainer/go/devcontainer.json":  `{"image": "go"}`,
+				".devcontainer/shared/setup.sh":       "echo",
+			},
+			configName: "jdk",
+			asConfig:   "java",
+			want: map[string]string{
+				".devcontainer/java/devcontainer.json": `{"build": {"dockerfile": "Dockerfile", "context": "../shared"}}`,
+				".devcontainer/java/Dockerfile":        "FROM java",
+				".devcontainer/shared/setup.sh":        "echo",
+			},
+			wantAbsent: []string{".devcontainer/jdk", ".devcontainer/go"},
+		},
+		{
+			name: "several configurations as named configuration",
+			files: map[string]string{
+				".devcontainer/jdk/devcontainer.json": `{"image": "java"}`,
+				".devcontainer/go/devcontainer.json":  `{"image": "go"}`,
+			},
+			asConfig: "java",
+			wantErr:  true,
+		},
+		{
+			name: "invalid configuration name",
+			files: map[string]string{
+				".devcontainer/devcontainer.json": `{"image": "java"}`,
+			},
+			asConfig: "../java",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "layouts", "version": "1.0.0", "name": "Layouts"}`)
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(src, name), content)
+			}
+
+			// Run from another directory, paths must be relative to the template
+			t.Chdir(t.TempDir())
+
+			target := t.TempDir()
+			for name, content := range tt.existing {
+				writeFile(t, filepath.Join(target, name), content)
+			}
+			config := devctmpl.NewConfig()
+			config.ConfigName = tt.configName
+			config.Layout = tt.layout
+			config.AsConfig = tt.asConfig
+			err := devctmpl.GenerateTemplateWithConfig(src, target, nil, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateTemplateWithConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			for name, want := range tt.want {
+				got, err := os.ReadFile(filepath.Join(target, name))
+				if err != nil {
+					t.Errorf("expected %s in output: %v", name, err)
+					continue
+				}
+				if strings.TrimSpace(string(got)) != want {
+					t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+				}
+			}
+			for _, name := range tt.wantAbsent {
+				if _, err := os.Stat(filepath.Join(target, name)); !os.IsNotExist(err) {
+					t.Errorf("expected %s not to exist, got err = %v", name, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package devctmpl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// SeverityOff disables a lint rule
+const SeverityOff Severity = "off"
+
+// lintConfigFile is the project lint configuration in the workspace folder
+const lintConfigFile = ".devcontainer-lint.json"
+
+// lintRule is a built-in lint rule with its default severity
+type lintRule struct {
+	Rule
+	severity Severity
+	check    func(doc *jsonc.Document) []lintFinding
+}
+
+// lintFinding is a problem found by a lint rule at a node of the config
+type lintFinding struct {
+	node    *jsonc.Node
+	message string
+}
+
+var lintRules = []lintRule{
+	{Rule{ID: "image-pinned", Description: "The image is pinned by digest or a version tag"}, SeverityWarning, lintImagePinned},
+	{Rule{ID: "no-root-user", Description: "The container does not run as root"}, SeverityWarning, lintNoRootUser},
+	{Rule{ID: "forward-ports", Description: "forwardPorts is declared"}, SeverityNote, lintForwardPorts},
+	{Rule{ID: "feature-pinned", Description: "Features are not used at their latest version"}, SeverityWarning, lintFeaturePinned},
+}
+
+// LintRules are the built-in rules run by Lint
+var LintRules = func() []Rule {
+	rules := make([]Rule, len(lintRules))
+	for i, rule := range lintRules {
+		rules[i] = rule.Rule
+	}
+	return rules
+}()
+
+// LintConfig sets the severity of lint rules. Rules not listed keep their
+// default severity, SeverityOff disables a rule.
+type LintConfig struct {
+	Rules map[string]Severity `json:"rules"`
+}
+
+// LoadLintConfig reads the user lint configuration
+// <user config dir>/devcontainer-template/lint.json, then the project
+// configuration .devcontainer-lint.json in workspace and finally files, each
+// overriding the severities set before it. Missing user and project
+// configurations are ignored.
+func LoadLintConfig(workspace string, files ...string) (*LintConfig, error) {
+	config := &LintConfig{Rules: make(map[string]Severity)}
+	var optional []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		optional = append(optional, filepath.Join(dir, "devcontainer-template", "lint.json"))
+	}
+	if workspace != "" {
+		optional = append(optional, filepath.Join(workspace, lintConfigFile))
+	}
+	for _, file := range optional {
+		if err := config.read(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	for _, file := range files {
+		if err := config.read(file); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// read merges the JSONC lint configuration file into c
+func (c *LintConfig) read(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	data, err := jsonc.ToJSON(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	var config LintConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	for id, severity := range config.Rules {
+		if !lintRuleExists(id) {
+			return fmt.Errorf("unknown lint rule '%s' in %s", id, file)
+		}
+		switch severity {
+		case SeverityError, SeverityWarning, SeverityNote, SeverityOff:
+		default:
+			return fmt.Errorf("invalid severity '%s' for lint rule '%s' in %s (allowed values: error, warning, note, off)", severity, id, file)
+		}
+		c.Rules[id] = severity
+	}
+	return nil
+}
+
+func lintRuleExists(id string) bool {
+	for _, rule := range lintRules {
+		if rule.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// severity returns the configured severity of rule
+func (c *LintConfig) severity(rule lintRule) Severity {
+	if c != nil {
+		if severity, ok := c.Rules[rule.ID]; ok {
+			return severity
+		}
+	}
+	return rule.severity
+}
+
+// Lint runs the built-in lint rules on the devcontainer.json files in dir
+// with the severities of config, the defaults if nil. File paths in issues
+// are joined with dir.
+func Lint(dir string, config *LintConfig) ([]Issue, error) {
+	issues, err := lint(dir, config)
+	for i := range issues {
+		issues[i].File = filepath.Join(dir, filepath.FromSlash(issues[i].File))
+	}
+	return issues, err
+}
+
+// lint is Lint with file paths relative to dir
+func lint(dir string, config *LintConfig) ([]Issue, error) {
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	for _, devcontainer := range configs {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(devcontainer.Path)))
+		if err != nil {
+			return nil, err
+		}
+		doc, err := jsonc.Parse(content)
+		if err != nil || doc.Root.Kind != jsonc.Object {
+			// Reported by CheckConfigs
+			continue
+		}
+		for _, rule := range lintRules {
+			severity := config.severity(rule)
+			if severity == SeverityOff {
+				continue
+			}
+			for _, finding := range rule.check(doc) {
+				line, _ := doc.Position(finding.node)
+				issues = append(issues, Issue{
+					Rule:     rule.ID,
+					Severity: severity,
+					Message:  finding.message,
+					File:     devcontainer.Path,
+					Line:     line,
+				})
+			}
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues, nil
+}
+
+// stringMember returns the string value of the member key of the root
+// object, or nil if it is not set or not a string
+func stringMember(doc *jsonc.Document, key string) (*jsonc.Node, string) {
+	member := doc.Root.Member(key)
+	if member == nil || member.Value.Kind != jsonc.String {
+		return nil, ""
+	}
+	var value string
+	if err := member.Value.Decode(&value); err != nil {
+		return nil, ""
+	}
+	return member.Value, value
+}
+
+// isVersionTag reports whether tag starts with a version number, such as 1,
+// 3.12 or 1-bookworm
+func isVersionTag(tag string) bool {
+	return tag != "" && tag[0] >= '0' && tag[0] <= '9'
+}
+
+func lintImagePinned(doc *jsonc.Document) []lintFinding {
+	node, image := stringMember(doc, "image")
+	if node == nil {
+		return nil
+	}
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil
+	}
+	if tag, ok := ref.(name.Tag); ok && !isVersionTag(tag.TagStr()) {
+		return []lintFinding{{node, fmt.Sprintf("image '%s' is not pinned by digest or a version tag", image)}}
+	}
+	return nil
+}
+
+func lintNoRootUser(doc *jsonc.Document) []lintFinding {
+	// remoteUser defaults to containerUser
+	for _, key := range []string{"remoteUser", "containerUser"} {
+		node, user := stringMember(doc, key)
+		if node == nil {
+			continue
+		}
+		if user == "root" || user == "0" {
+			return []lintFinding{{node, fmt.Sprintf("%s is root", key)}}
+		}
+		return nil
+	}
+	return nil
+}
+
+func lintForwardPorts(doc *jsonc.Document) []lintFinding {
+	if member := doc.Root.Member("forwardPorts"); member != nil && len(member.Value.Elements) > 0 {
+		return nil
+	}
+	return []lintFinding{{doc.Root, "forwardPorts is not declared"}}
+}
+
+func lintFeaturePinned(doc *jsonc.Document) []lintFinding {
+	features := doc.Root.Member("features")
+	if features == nil || features.Value.Kind != jsonc.Object {
+		return nil
+	}
+	var findings []lintFinding
+	for _, member := range features.Value.Members {
+		if !isOCIFeature(member.Key) {
+			continue
+		}
+		ref, err := name.ParseReference(member.Key)
+		if err != nil {
+			continue
+		}
+		if tag, ok := ref.(name.Tag); ok && tag.TagStr() == "latest" {
+			id := strings.TrimSuffix(member.Key, ":latest")
+			findings = append(findings, lintFinding{member.Value, fmt.Sprintf("feature '%s' uses the latest version", id)})
+		}
+	}
+	return findings
+}
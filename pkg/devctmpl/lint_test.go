@@ -0,0 +1,137 @@
+package devctmpl_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		rules  map[string]devctmpl.Severity
+		want   []string
+	}{
+		{
+			name: "clean",
+			config: `{
+	"image": "mcr.microsoft.com/devcontainers/go:1-1.22-bookworm",
+	"remoteUser": "vscode",
+	"forwardPorts": [8080],
+	"features": {"ghcr.io/devcontainers/features/node:1": {}}
+}`,
+		},
+		{
+			name: "violations",
+			config: `{
+	"image": "mcr.microsoft.com/devcontainers/go",
+	"remoteUser": "root",
+	"features": {
+		"ghcr.io/devcontainers/features/node:latest": {},
+		"ghcr.io/devcontainers/features/go": {}
+	}
+}`,
+			want: []string{
+				"1: note: forwardPorts is not declared [forward-ports]",
+				"2: warning: image 'mcr.microsoft.com/devcontainers/go' is not pinned by digest or a version tag [image-pinned]",
+				"3: warning: remoteUser is root [no-root-user]",
+				"5: warning: feature 'ghcr.io/devcontainers/features/node' uses the latest version [feature-pinned]",
+				"6: warning: feature 'ghcr.io/devcontainers/features/go' uses the latest version [feature-pinned]",
+			},
+		},
+		{
+			name:   "configured severities",
+			config: "{\n\t\"image\": \"debian:bookworm\",\n\t\"containerUser\": \"root\"\n}",
+			rules:  map[string]devctmpl.Severity{"image-pinned": "error", "forward-ports": "off"},
+			want: []string{
+				"2: error: image 'debian:bookworm' is not pinned by digest or a version tag [image-pinned]",
+				"3: warning: containerUser is root [no-root-user]",
+			},
+		},
+		{
+			name:   "digest",
+			config: `{"image": "debian@sha256:0000000000000000000000000000000000000000000000000000000000000000", "forwardPorts": [80]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := filepath.Join(dir, ".devcontainer.json")
+			writeFile(t, config, tt.config)
+
+			issues, err := devctmpl.Lint(dir, &devctmpl.LintConfig{Rules: tt.rules})
+			if err != nil {
+				t.Fatalf("Lint() error = %v", err)
+			}
+			if len(issues) != len(tt.want) {
+				t.Fatalf("Lint() = %v, want %d issues", issues, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := issues[i].String(); got != config+":"+want {
+					t.Errorf("issue %d = %q, want %q", i, got, config+":"+want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadLintConfig(t *testing.T) {
+	userDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	writeFile(t, filepath.Join(userDir, "devcontainer-template", "lint.json"), `{"rules": {"image-pinned": "error", "no-root-user": "error"}}`)
+
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, ".devcontainer-lint.json"), "{\n\t// Compose services publish their own ports\n\t\"rules\": {\"forward-ports\": \"off\", \"no-root-user\": \"note\"},\n}")
+	extra := filepath.Join(t.TempDir(), "lint.json")
+	writeFile(t, extra, `{"rules": {"feature-pinned": "note"}}`)
+
+	config, err := devctmpl.LoadLintConfig(workspace, extra)
+	if err != nil {
+		t.Fatalf("LoadLintConfig() error = %v", err)
+	}
+	want := map[string]devctmpl.Severity{"image-pinned": "error", "no-root-user": "note", "forward-ports": "off", "feature-pinned": "note"}
+	if len(config.Rules) != len(want) {
+		t.Errorf("LoadLintConfig() rules = %v, want %v", config.Rules, want)
+	}
+	for id, severity := range want {
+		if config.Rules[id] != severity {
+			t.Errorf("rule %s severity = %q, want %q", id, config.Rules[id], severity)
+		}
+	}
+
+	writeFile(t, extra, `{"rules": {"no-latest": "error"}}`)
+	if _, err := devctmpl.LoadLintConfig(workspace, extra); err == nil || !strings.Contains(err.Error(), "unknown lint rule 'no-latest'") {
+		t.Errorf("LoadLintConfig() error = %v, want unknown rule error", err)
+	}
+	writeFile(t, extra, `{"rules": {"image-pinned": "fatal"}}`)
+	if _, err := devctmpl.LoadLintConfig(workspace, extra); err == nil || !strings.Contains(err.Error(), "invalid severity 'fatal'") {
+		t.Errorf("LoadLintConfig() error = %v, want invalid severity error", err)
+	}
+}
+
+func TestGenerateTemplateLint(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "lint", "version": "1.0.0", "name": "Lint"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), `{"image": "debian", "forwardPorts": [80]}`)
+
+	var issues []devctmpl.Issue
+	config := devctmpl.NewConfig()
+	config.Lint = &devctmpl.LintConfig{}
+	config.OnIssue = func(issue devctmpl.Issue) { issues = append(issues, issue) }
+	if err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), nil, config); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+	if len(issues) != 1 || issues[0].Rule != "image-pinned" || issues[0].Severity != devctmpl.SeverityWarning {
+		t.Errorf("OnIssue got %v, want an image-pinned warning", issues)
+	}
+
+	config.Lint = &devctmpl.LintConfig{Rules: map[string]devctmpl.Severity{"image-pinned": "error"}}
+	err := devctmpl.GenerateTemplateWithConfig(src, t.TempDir(), nil, config)
+	if err == nil || !strings.Contains(err.Error(), "violates lint rules") {
+		t.Errorf("GenerateTemplateWithConfig() error = %v, want lint error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package devctmpl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// Lockfile is a devcontainer-lock.json, pinning the features of a
+// configuration by digest in the format of the devcontainers CLI
+type Lockfile struct {
+	Features map[string]LockedFeature `json:"features"`
+}
+
+// LockedFeature is the resolved version of a feature
+type LockedFeature struct {
+	Version string `json:"version"`
+	// Resolved is the feature reference pinned by digest
+	Resolved string `json:"resolved"`
+	// Integrity is the manifest digest
+	Integrity string `json:"integrity"`
+}
+
+// lockFilePath returns the path of the lockfile of a devcontainer.json:
+// devcontainer-lock.json next to it, or .devcontainer-lock.json for a
+// .devcontainer.json
+func lockFilePath(config string) string {
+	name := strings.TrimSuffix(filepath.Base(config), ".json") + "-lock.json"
+	return filepath.Join(filepath.Dir(config), name)
+}
+
+// ReadLockfile reads the lockfile of the devcontainer.json config, or returns
+// nil if it doesn't have one
+func ReadLockfile(config string) (*Lockfile, error) {
+	data, err := os.ReadFile(lockFilePath(config))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", lockFilePath(config), err)
+	}
+	return &lock, nil
+}
+
+// LockFeatures writes the lockfile of the devcontainer.json of workspace, the
+// named sub-configuration if configName is set. Features already locked keep
+// their version unless update is set; features no longer used are dropped.
+// If resolver is nil a shared resolver is used.
+func LockFeatures(workspace string, configName string, update bool, resolver *FeatureResolver) (*Lockfile, error) {
+	config, err := workspaceConfig(workspace, configName)
+	if err != nil {
+		return nil, err
+	}
+	return lockConfig(config, update, resolver)
+}
+
+// lockFeatures writes the lockfiles of the devcontainer.json files in dir
+func lockFeatures(dir string, resolver *FeatureResolver) error {
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		if _, err := lockConfig(filepath.Join(dir, filepath.FromSlash(config.Path)), true, resolver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockConfig resolves the OCI features of the devcontainer.json config and
+// writes its lockfile
+func lockConfig(config string, update bool, resolver *FeatureResolver) (*Lockfile, error) {
+	if resolver == nil {
+		resolver = defaultFeatureResolver
+	}
+	content, err := os.ReadFile(config)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonc.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", config, err)
+	}
+	features, err := configFeatures(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid features in %s: %w", config, err)
+	}
+
+	previous := &Lockfile{}
+	if !update {
+		if lock, err := ReadLockfile(config); err != nil {
+			return nil, err
+		} else if lock != nil {
+			previous = lock
+		}
+	}
+
+	lock := &Lockfile{Features: make(map[string]LockedFeature)}
+	for _, feature := range features {
+		if !isOCIFeature(feature.ID) {
+			continue
+		}
+		if locked, ok := previous.Features[feature.ID]; ok {
+			lock.Features[feature.ID] = locked
+			continue
+		}
+		metadata, digest, err := resolver.Resolve(feature.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve feature '%s': %w", feature.ID, err)
+		}
+		resolved, err := pinOCIReference(feature.ID, digest)
+		if err != nil {
+			return nil, err
+		}
+		lock.Features[feature.ID] = LockedFeature{Version: metadata.Version, Resolved: resolved, Integrity: digest}
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, lock); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(lockFilePath(config), buf.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write lockfile: %w", err)
+	}
+	return lock, nil
+}
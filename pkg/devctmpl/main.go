@@ -1,15 +1,16 @@
 package devctmpl
 
 import (
+	"context"
 	"embed"
 	_ "embed"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
-	"sort"
+	"slices"
 	"strings"
 
 	"github.com/hashicorp/go-getter"
@@ -38,12 +39,60 @@ type DevContainerTemplate struct {
 	Publisher        string                    `json:"publisher,omitempty"`
 	Keywords         []string                  `json:"keywords,omitempty"`
 	OptionalPaths    []string                  `json:"optionalPaths,omitempty"`
+	// SubstitutionExclude lists paths that are copied verbatim, without
+	// replacing template options
+	SubstitutionExclude []string `json:"substitutionExclude,omitempty"`
 }
 
+// templateMetadataFiles describe a template and are not applied to a workspace
+var templateMetadataFiles = []string{"devcontainer-template.json", "README.md", "NOTES.md"}
+
 type Config struct {
 	TmpRootDir string
 	KeepTmpDir bool
-	OmitPaths  []string
+	// OmitPaths are patterns selecting optional paths of the template that
+	// are not applied. Patterns that match no optional path are errors.
+	OmitPaths []string
+	// ConfigName selects a single .devcontainer/<name> sub-configuration
+	ConfigName string
+	// Layout converts the configuration to a root file or folder layout
+	Layout Layout
+	// AsConfig moves the configuration to the named sub-configuration
+	// .devcontainer/<name>/, so it is added next to the existing ones
+	AsConfig string
+	// TargetSubdir writes the template to a relative path inside the target
+	// directory, which stays the workspace of the configuration
+	TargetSubdir string
+	// Features are added to the generated configuration, merging the
+	// options of features it already uses
+	Features []Feature
+	// CheckFeatures checks that the features used by the generated
+	// configuration exist and accept their options
+	CheckFeatures bool
+	// FeatureResolver fetches feature metadata, a shared resolver if nil
+	FeatureResolver *FeatureResolver
+	// CheckImages requests the manifest of every image of the generated
+	// configuration from its registry and fails if one is missing. Image
+	// references are always checked to parse.
+	CheckImages bool
+	// Lock writes a devcontainer-lock.json pinning the features of the
+	// generated configuration by digest
+	Lock bool
+	// Strict rejects generated devcontainer.json files that are not
+	// well-formed JSONC, have duplicate keys or don't match the
+	// devcontainer.json schema
+	Strict bool
+	// Lint runs the built-in lint rules on the generated configuration with
+	// these severities. Issues with error severity fail the apply.
+	Lint *LintConfig
+	// OnIssue receives the problems found in the generated devcontainer.json
+	// files that don't fail the apply
+	OnIssue func(Issue)
+	// OnConflict decides what happens to existing files that differ from
+	// the template, ConflictFail if empty
+	OnConflict ConflictPolicy
+	// Prompt chooses the policy per file when OnConflict is ConflictPrompt
+	Prompt ConflictPromptFunc
 }
 
 // NewConfig creates a new Config with default values
@@ -51,6 +100,7 @@ func NewConfig() Config {
 	return Config{
 		KeepTmpDir: false,
 		OmitPaths:  []string{},
+		OnConflict: ConflictFail,
 	}
 }
 
@@ -59,20 +109,79 @@ func GenerateTemplate(source string, target string, options map[string]string) e
 }
 
 func GenerateTemplateWithConfig(source string, target string, options map[string]string, cfg Config) error {
+	return GenerateTemplateWithContext(context.Background(), source, target, options, cfg)
+}
+
+// GenerateTemplateWithContext applies a template like GenerateTemplateWithConfig.
+// The target directory is changed in a single transaction: if writing fails
+// or ctx is cancelled, all changes are rolled back.
+func GenerateTemplateWithContext(ctx context.Context, source string, target string, options map[string]string, cfg Config) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rendered, err := renderTemplate(source, options, cfg)
+	if err != nil {
+		return err
+	}
+	defer rendered.cleanup()
+
+	// Copy processed template to target directory
+	return applyRendered(ctx, rendered, target, cfg)
+}
+
+// renderedTemplate is a template rendered into a temporary directory
+type renderedTemplate struct {
+	dir      string
+	template *DevContainerTemplate
+	// source is the template source and digest its OCI manifest digest or
+	// the hash of the template files
+	source string
+	digest string
+	// options are the options as given, before defaults were applied
+	options map[string]string
+	// omitted are the template files left out because of Config.OmitPaths
+	omitted []string
+	cleanup func()
+}
+
+// renderTemplate prepares the source and renders it with the given options
+// into a temporary directory. The caller must call cleanup on the result.
+func renderTemplate(source string, options map[string]string, cfg Config) (*renderedTemplate, error) {
 	// Prepare source directory
-	source, cleanup, err := prepareSource(source, cfg.TmpRootDir)
+	dir, digest, cleanupSource, err := prepareSource(source, cfg.TmpRootDir)
 	if err != nil {
-		return fmt.Errorf("failed to prepare source: %w", err)
+		return nil, fmt.Errorf("failed to prepare source: %w", err)
 	}
 
-	if !cfg.KeepTmpDir {
-		defer cleanup()
+	rendered := &renderedTemplate{
+		source:  source,
+		digest:  digest,
+		options: options,
+		cleanup: func() {
+			if !cfg.KeepTmpDir {
+				cleanupSource()
+			}
+		},
+	}
+	if rendered.digest == "" {
+		if rendered.digest, err = treeDigest(dir); err != nil {
+			rendered.cleanup()
+			return nil, fmt.Errorf("failed to hash template source: %w", err)
+		}
+	}
+	if err := rendered.render(dir, options, cfg); err != nil {
+		rendered.cleanup()
+		return nil, err
 	}
+	return rendered, nil
+}
 
+func (r *renderedTemplate) render(source string, options map[string]string, cfg Config) error {
 	template, err := loadTemplate(source)
 	if err != nil {
 		return err
 	}
+	r.template = template
 
 	// If template has no options defined but options were provided
 	if template.Options == nil && len(options) > 0 {
@@ -83,32 +192,125 @@ func GenerateTemplateWithConfig(source string, target string, options map[string
 	if err := checkOptions(template, options); err != nil {
 		return err
 	}
-	tmpDir, err := copyTemplateToTemp(source, template, cfg.TmpRootDir, cfg.OmitPaths)
+
+	// Add default values for options not provided
+	options, err = resolveOptions(template, options)
 	if err != nil {
 		return err
 	}
 
-	// Add default values for options not provided
-	for optName, optDef := range template.Options {
-		if _, exists := options[optName]; !exists && optDef.Default != "" {
-			options[optName] = optDef.Default
+	optional, err := compilePathPatterns(template.OptionalPaths)
+	if err != nil {
+		return fmt.Errorf("invalid optionalPaths in template: %w", err)
+	}
+	exclude, err := compilePathPatterns(template.SubstitutionExclude)
+	if err != nil {
+		return fmt.Errorf("invalid substitutionExclude in template: %w", err)
+	}
+	omit, err := compilePathPatterns(cfg.OmitPaths)
+	if err != nil {
+		return fmt.Errorf("invalid omit paths: %w", err)
+	}
+	var subdir string
+	if cfg.TargetSubdir != "" {
+		if subdir, err = cleanSubdir(cfg.TargetSubdir); err != nil {
+			return err
+		}
+	}
+
+	tmpDir, omitted, err := copyTemplateToTemp(source, cfg.TmpRootDir, optional, omit, cfg.OmitPaths)
+	if err != nil {
+		return err
+	}
+	r.dir = tmpDir
+	r.omitted = omitted
+	cleanupSource := r.cleanup
+	r.cleanup = func() {
+		if !cfg.KeepTmpDir {
+			os.RemoveAll(r.dir)
 		}
+		cleanupSource()
 	}
 
-	if err := replaceTemplateOptions(tmpDir, options); err != nil {
+	if err := replaceTemplateOptions(tmpDir, options, exclude); err != nil {
 		return fmt.Errorf("failed to replace template options: %w", err)
 	}
 
-	// Create target directory if it doesn't exist
-	if err := os.MkdirAll(target, 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
+	if err := renderGoTemplates(tmpDir, template, options, exclude); err != nil {
+		return err
 	}
 
-	// Copy processed template to target directory
-	if err := copy.Copy(tmpDir, target); err != nil {
-		return fmt.Errorf("failed to copy template to target directory: %w", err)
+	if err := selectDevContainerConfig(tmpDir, cfg.ConfigName, cfg.Layout); err != nil {
+		return err
+	}
+	if cfg.AsConfig != "" {
+		if cfg.Layout != LayoutKeep {
+			return fmt.Errorf("a layout can't be combined with applying the template as configuration '%s'", cfg.AsConfig)
+		}
+		if err := relocateDevContainerConfig(tmpDir, cfg.AsConfig); err != nil {
+			return err
+		}
+	}
+	if err := addFeatures(tmpDir, cfg.Features); err != nil {
+		return err
+	}
+	if cfg.CheckFeatures {
+		issues, err := checkFeatures(tmpDir, cfg.FeatureResolver)
+		if err != nil {
+			return fmt.Errorf("failed to check features: %w", err)
+		}
+		if err := issuesError("generated configuration uses invalid features", issues); err != nil {
+			return err
+		}
+	}
+	if cfg.Lock {
+		if err := lockFeatures(tmpDir, cfg.FeatureResolver); err != nil {
+			return fmt.Errorf("failed to lock features: %w", err)
+		}
+	}
+	issues, err := checkConfigs(tmpDir)
+	if err != nil {
+		return fmt.Errorf("failed to check generated configuration: %w", err)
+	}
+	imageIssues, err := checkImages(tmpDir, cfg.CheckImages)
+	if err != nil {
+		return fmt.Errorf("failed to check images: %w", err)
+	}
+	if cfg.CheckImages {
+		if err := issuesError("generated configuration uses missing images", imageIssues); err != nil {
+			return err
+		}
+	}
+	issues = append(issues, imageIssues...)
+	if cfg.Strict {
+		if err := issuesError("generated configuration is invalid", issues); err != nil {
+			return err
+		}
+	}
+	if cfg.Lint != nil {
+		lintIssues, err := lint(tmpDir, cfg.Lint)
+		if err != nil {
+			return fmt.Errorf("failed to lint generated configuration: %w", err)
+		}
+		if err := issuesError("generated configuration violates lint rules", lintIssues); err != nil {
+			return err
+		}
+		issues = append(issues, lintIssues...)
 	}
 
+	if subdir != "" {
+		if err := r.moveToSubdir(subdir, cfg.TmpRootDir); err != nil {
+			return err
+		}
+		for i := range issues {
+			issues[i].File = path.Join(subdir, issues[i].File)
+		}
+	}
+	if cfg.OnIssue != nil {
+		for _, issue := range issues {
+			cfg.OnIssue(issue)
+		}
+	}
 	return nil
 }
 
@@ -146,163 +348,161 @@ func GenerateFromEmbedWithConfig(source embed.FS, target string, options map[str
 	return GenerateTemplateWithConfig(tmpDir, target, options, cfg)
 }
 
+// LoadTemplate fetches a template source the same way GenerateTemplateWithConfig
+// does and returns its devcontainer-template.json metadata
+func LoadTemplate(source string, cfg Config) (*DevContainerTemplate, error) {
+	source, _, cleanup, err := prepareSource(source, cfg.TmpRootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare source: %w", err)
+	}
+
+	if !cfg.KeepTmpDir {
+		defer cleanup()
+	}
+
+	return loadTemplate(source)
+}
+
 func getTmpDir(tmpRootDir string, pattern string) (string, error) {
 	// Create temporary directory
 	return os.MkdirTemp(tmpRootDir, pattern)
 }
 
-// CopyTemplateToTemp copies the template files to a temporary directory
-func copyTemplateToTemp(sourceDir string, template *DevContainerTemplate, tmpRootDir string, omitPaths []string) (string, error) {
+// CopyTemplateToTemp copies the template files to a temporary directory.
+// As the template spec requires, every file is applied except the template
+// metadata files. Optional paths are included unless the user omits them
+// with omit, compiled from omitPaths; the omitted files are returned.
+func copyTemplateToTemp(sourceDir string, tmpRootDir string, optional *pathMatcher, omit *pathMatcher, omitPaths []string) (string, []string, error) {
 	tmpDir, err := getTmpDir(tmpRootDir, "devcontainer-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
+		return "", nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
-	devContainerLocation, err := findDevContainerJson(sourceDir)
-	if err != nil {
+	if _, err := findDevContainerJson(sourceDir); err != nil {
 		os.RemoveAll(tmpDir)
-		return "", err
+		return "", nil, err
 	}
 
-	if devContainerLocation != devContainerDir {
-		if err := copy.Copy(".devcontainer.json", tmpDir); err != nil {
-			os.RemoveAll(tmpDir)
-			return "", fmt.Errorf("failed to copy .devcontainer.json file: %w", err)
-		}
+	opts := copy.Options{
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			if info.IsDir() && info.Name() == ".git" {
+				return true, nil
+			}
+			rel, err := filepath.Rel(sourceDir, src)
+			if err != nil {
+				return false, err
+			}
+			return slices.Contains(templateMetadataFiles, filepath.ToSlash(rel)), nil
+		},
+	}
+	if err := copy.Copy(sourceDir, tmpDir, opts); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", nil, fmt.Errorf("failed to copy template files: %w", err)
 	}
 
-	if devContainerLocation != parentDir {
-		// Copy .devcontainer folder
-		devcontainerSrc := filepath.Join(sourceDir, ".devcontainer")
-		devcontainerDst := filepath.Join(tmpDir, ".devcontainer")
-
-		if err := copy.Copy(devcontainerSrc, devcontainerDst); err != nil {
-			os.RemoveAll(tmpDir)
-			return "", fmt.Errorf("failed to copy .devcontainer folder: %w", err)
-		}
+	if err := checkOmitPaths(tmpDir, optional, omitPaths); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", nil, err
+	}
+	omitted, err := removeMatchingPaths(tmpDir, func(path string, isDir bool) bool {
+		return omit.match(path, isDir) && optional.match(path, isDir)
+	})
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", nil, err
 	}
 
-	// Copy optional paths
-	sourceDirFs := os.DirFS(sourceDir)
-	for _, pattern := range template.OptionalPaths {
+	return tmpDir, omitted, nil
+}
 
-		if strings.HasPrefix(pattern, "/*") && len(pattern) > 3 {
-			dirToCopy := strings.TrimPrefix(pattern, "/*")
-			if info, err := fs.Stat(sourceDirFs, dirToCopy); err == nil && info.IsDir() {
-				if err := copy.Copy(filepath.Join(sourceDir, dirToCopy), filepath.Join(tmpDir, dirToCopy)); err != nil {
-					os.RemoveAll(tmpDir)
-					return "", fmt.Errorf("failed to copy directory '%s': %w", dirToCopy, err)
-				}
-			}
-		} else {
-			if info, err := fs.Stat(sourceDirFs, pattern); err == nil && !info.IsDir() {
-				if err := copy.Copy(filepath.Join(sourceDir, pattern), filepath.Join(tmpDir, pattern)); err != nil {
-					os.RemoveAll(tmpDir)
-					return "", fmt.Errorf("failed to copy file '%s': %w", pattern, err)
-				}
-			}
+// checkOmitPaths checks that each of the omit patterns matches an optional
+// file of the template in dir, since only optional paths can be omitted
+func checkOmitPaths(dir string, optional *pathMatcher, omitPaths []string) error {
+	for _, pattern := range omitPaths {
+		compiled, err := compilePathPattern(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid omit paths: %w", err)
 		}
-	}
+		// A negated pattern has to match an optional path to have an effect
+		compiled.negate = false
+		m := &pathMatcher{patterns: []pathPattern{compiled}}
 
-	// Remove folders and files in tmpDir that match omitPaths globs
-	tmpDirFs := os.DirFS(tmpDir)
-	for _, pattern := range omitPaths {
-		if strings.HasPrefix(pattern, "/*") && len(pattern) > 3 {
-			dirToRemove := strings.TrimPrefix(pattern, "/*")
-			if info, err := fs.Stat(tmpDirFs, dirToRemove); err == nil && info.IsDir() {
-				if err := os.RemoveAll(filepath.Join(tmpDir, dirToRemove)); err != nil {
-					os.RemoveAll(tmpDir)
-					return "", fmt.Errorf("failed to remove directory '%s': %w", dirToRemove, err)
-				}
+		matched := false
+		err = fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
 			}
-		} else {
-			if info, err := fs.Stat(tmpDirFs, pattern); err == nil && !info.IsDir() {
-				if err := os.Remove(filepath.Join(tmpDir, pattern)); err != nil {
-					os.RemoveAll(tmpDir)
-					return "", fmt.Errorf("failed to remove file '%s': %w", pattern, err)
-				}
+			if !d.IsDir() && m.match(path, false) && optional.match(path, false) {
+				matched = true
+				return fs.SkipAll
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !matched {
+			return fmt.Errorf("omit path '%s' does not match any optional path of the template", pattern)
 		}
 	}
-
-	return tmpDir, nil
+	return nil
 }
 
-// func validateTemplateOptions(options map[string]string, templateOptions map[string]TemplateOption) error {
-// 	for key, option := range templateOptions {
-
-// 	}
-// 	return nil
-// }
-
-// ReplaceTemplateOptions walks through all files in the directory and replaces
-// template variables of the form ${templateOption:key} with their corresponding values
-func replaceTemplateOptions(dir string, options map[string]string) error {
-	// Compile regex for finding template variables
-	varRegex := regexp.MustCompile(`\${templateOption:([^}]+)}`)
-
-	return fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
+// removeMatchingPaths removes the files in dir matched by match, and
+// directories that are matched or had files removed and are left empty. It
+// returns the removed files.
+func removeMatchingPaths(dir string, match func(path string, isDir bool) bool) ([]string, error) {
+	var dirs, removed []string
+	touched := make(map[string]bool)
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
 			return err
 		}
-
-		// Skip directories
 		if d.IsDir() {
+			dirs = append(dirs, name)
+			if match(name, true) {
+				touched[name] = true
+			}
 			return nil
 		}
-
-		// Read file content
-		content, err := os.ReadFile(filepath.Join(dir, path))
-		if err != nil {
-			return fmt.Errorf("failed to read file %s: %w", path, err)
-		}
-
-		// Check if file contains any template variables
-		if !varRegex.Match(content) {
+		if !match(name, false) {
 			return nil
 		}
-
-		// Replace all template variables
-		newContent := varRegex.ReplaceAllFunc(content, func(match []byte) []byte {
-			// Extract key from ${templateOption:key}
-			key := varRegex.FindSubmatch(match)[1]
-
-			// Get value from options map
-			if value, exists := options[string(key)]; exists {
-				return []byte(value)
-			}
-			// If no value found, leave original template variable
-			return match
-		})
-
-		// Write modified content back to file
-		if err := os.WriteFile(filepath.Join(dir, path), newContent, d.Type().Perm()); err != nil {
-			return fmt.Errorf("failed to write file %s: %w", path, err)
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("failed to remove file '%s': %w", name, err)
+		}
+		removed = append(removed, name)
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			touched[parent] = true
 		}
-
 		return nil
 	})
-}
-
-func checkOptions(template *DevContainerTemplate, options map[string]string) error {
-	names := make([]string, 0, len(template.Options))
-	if options == nil {
-		options = make(map[string]string)
-	}
-	for name := range template.Options {
-		names = append(names, name)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(names)
 
-	for optName := range options {
-		if _, exists := template.Options[optName]; !exists {
-			return fmt.Errorf("option '%s' is not defined in template (available options: %v)",
-				optName,
-				names,
-			)
+	// Deepest directories first, so parents can become empty
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if !touched[dirs[i]] {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(dir, dirs[i]))
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, dirs[i])); err != nil {
+			return nil, fmt.Errorf("failed to remove directory '%s': %w", dirs[i], err)
 		}
 	}
-	return nil
+	return removed, nil
+}
+
+// checkOptions validates the provided options with the options schema of the template
+func checkOptions(template *DevContainerTemplate, options map[string]string) error {
+	return OptionsSchema(template).Validate(typedOptions(template, options))
 }
 
 func parseTemplate(content []byte) (*DevContainerTemplate, error) {
@@ -313,53 +513,58 @@ func parseTemplate(content []byte) (*DevContainerTemplate, error) {
 	return &template, nil
 }
 
-type devContainerLocation int
-
-const (
-	parentDir devContainerLocation = iota
-	devContainerDir
-	parentAndDevContainer
-)
+// devContainerConfig is a devcontainer.json found in a template or workspace
+type devContainerConfig struct {
+	// Name of a .devcontainer/<name>/devcontainer.json sub-configuration,
+	// empty for .devcontainer.json and .devcontainer/devcontainer.json
+	Name string
+	// Path is the slash separated path of the file relative to the root
+	Path string
+}
 
-// Helper function to check if a specific devcontainer.json file exists
+// Helper function to check if a specific devcontainer.json file, or a .tmpl
+// file rendering it, exists
 func checkDevContainerJson(path string) bool {
-	_, err := os.Stat(path)
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	_, err := os.Stat(path + goTemplateSuffix)
 	return err == nil
 }
 
-func findDevContainerJson(dir string) (devContainerLocation, error) {
+// findDevContainerJson returns the configurations in dir in the three
+// supported layouts: .devcontainer.json, .devcontainer/devcontainer.json and
+// .devcontainer/<name>/devcontainer.json
+func findDevContainerJson(dir string) ([]devContainerConfig, error) {
+	var configs []devContainerConfig
+
 	// Check if .devcontainer.json exists in the parent directory
-	devcontainerJsonPath := filepath.Join(dir, ".devcontainer.json")
-	parentExists := checkDevContainerJson(devcontainerJsonPath)
+	if checkDevContainerJson(filepath.Join(dir, ".devcontainer.json")) {
+		configs = append(configs, devContainerConfig{Path: ".devcontainer.json"})
+	}
 
 	// Check if .devcontainer/devcontainer.json exists
-	devcontainerPath := filepath.Join(dir, ".devcontainer", "devcontainer.json")
-	devContainerExists := checkDevContainerJson(devcontainerPath)
+	if checkDevContainerJson(filepath.Join(dir, ".devcontainer", "devcontainer.json")) {
+		configs = append(configs, devContainerConfig{Path: ".devcontainer/devcontainer.json"})
+	}
 
 	// Check if .devcontainer/<folder>/devcontainer.json exists (one level deep)
-	devcontainerDir := filepath.Join(dir, ".devcontainer")
-	entries, err := os.ReadDir(devcontainerDir)
+	entries, err := os.ReadDir(filepath.Join(dir, ".devcontainer"))
 	if err == nil {
 		for _, entry := range entries {
-			if entry.IsDir() {
-				subDirPath := filepath.Join(devcontainerDir, entry.Name(), "devcontainer.json")
-				if checkDevContainerJson(subDirPath) {
-					devContainerExists = true
-					break
-				}
+			if entry.IsDir() && checkDevContainerJson(filepath.Join(dir, ".devcontainer", entry.Name(), "devcontainer.json")) {
+				configs = append(configs, devContainerConfig{
+					Name: entry.Name(),
+					Path: ".devcontainer/" + entry.Name() + "/devcontainer.json",
+				})
 			}
 		}
 	}
 
-	if parentExists && devContainerExists {
-		return parentAndDevContainer, nil
-	} else if parentExists {
-		return parentDir, nil
-	} else if devContainerExists {
-		return devContainerDir, nil
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("devcontainer.json not found in %s or its subdirectories", dir)
 	}
-
-	return 0, fmt.Errorf("devcontainer.json not found in %s or its subdirectories", dir)
+	return configs, nil
 }
 
 func loadTemplate(dir string) (*DevContainerTemplate, error) {
@@ -382,18 +587,19 @@ func loadTemplate(dir string) (*DevContainerTemplate, error) {
 	return template, nil
 }
 
-// PrepareSource downloads/copies the source to a temporary directory
-func prepareSource(source string, tmpDirRoot string) (string, func(), error) {
+// prepareSource makes source available as a local directory. For OCI
+// references it also returns the manifest digest of the pulled template.
+func prepareSource(source string, tmpDirRoot string) (string, string, func(), error) {
 	nocleanup := func() {}
 
 	// For local directories, use copy instead of go-getter
 	if info, err := os.Stat(source); err == nil && info.IsDir() {
-		return source, nocleanup, nil
+		return source, "", nocleanup, nil
 	}
 
 	tmpDir, err := getTmpDir(tmpDirRoot, "devcontainer-source-*")
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to create temp directory: %w", err)
+		return "", "", nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
 	cleanup := func() {
@@ -402,17 +608,18 @@ func prepareSource(source string, tmpDirRoot string) (string, func(), error) {
 
 	// Check if it's an OCI reference
 	if isOCIRepository(source) {
-		if err := pullOCITemplate(source, tmpDir); err != nil {
+		digest, err := pullOCITemplate(source, tmpDir)
+		if err != nil {
 			cleanup()
-			return "", nil, err
+			return "", "", nil, err
 		}
-		return tmpDir, cleanup, nil
+		return tmpDir, digest, cleanup, nil
 	}
 
 	pwd, err := os.Getwd()
 	if err != nil {
 		cleanup()
-		return "", nil, fmt.Errorf("failed to get current directory: %w", err)
+		return "", "", nil, fmt.Errorf("failed to get current directory: %w", err)
 	}
 
 	// Expand . and .. if source starts with file://
@@ -430,17 +637,17 @@ func prepareSource(source string, tmpDirRoot string) (string, func(), error) {
 
 	if err := client.Get(); err != nil {
 		cleanup()
-		return "", nil, fmt.Errorf("failed to get source: %w", err)
+		return "", "", nil, fmt.Errorf("failed to get source: %w", err)
 	}
 
 	// Find the actual template directory
 	templateDir, err := findTemplateDir(tmpDir)
 	if err != nil {
 		cleanup()
-		return "", nil, err
+		return "", "", nil, err
 	}
 
-	return templateDir, cleanup, nil
+	return templateDir, "", cleanup, nil
 }
 
 func findTemplateDir(dir string) (string, error) {
@@ -44,3 +44,127 @@ func TestCheckTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestComputedDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		args    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "derived default",
+			options: `{
+				"version": {"type": "string", "description": "Version", "default": "21"},
+				"variant": {"type": "string", "description": "Variant", "default": "bookworm"},
+				"imageTag": {"type": "string", "description": "Tag", "default": "${templateOption:version}-${templateOption:variant}"}
+			}`,
+			args: map[string]string{"variant": "bullseye"},
+			want: "21-bullseye",
+		},
+		{
+			name: "overridden default",
+			options: `{
+				"version": {"type": "string", "description": "Version", "default": "21"},
+				"imageTag": {"type": "string", "description": "Tag", "default": "${templateOption:version}"}
+			}`,
+			args: map[string]string{"imageTag": "${templateOption:version}"},
+			want: "${templateOption:version}",
+		},
+		{
+			name: "cycle",
+			options: `{
+				"a": {"type": "string", "description": "A", "default": "${templateOption:imageTag}"},
+				"imageTag": {"type": "string", "description": "Tag", "default": "${templateOption:a}"}
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "unknown reference",
+			options: `{
+				"imageTag": {"type": "string", "description": "Tag", "default": "${templateOption:nope}"}
+			}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeFile(t, filepath.Join(src, "devcontainer-template.json"),
+				`{"id": "computed", "version": "1.0.0", "name": "Computed", "options": `+tt.options+`}`)
+			writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), `{"image": "java:${templateOption:imageTag}"}`)
+
+			target := t.TempDir()
+			err := devctmpl.GenerateTemplate(src, target, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := os.ReadFile(filepath.Join(target, ".devcontainer", "devcontainer.json"))
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if want := `{"image": "java:` + tt.want + `"}`; string(got) != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateFileSelection(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "files", "version": "1.0.0", "name": "Files",
+		"optionalPaths": [".github/dependabot.yml"]
+	}`)
+	writeFile(t, filepath.Join(src, "README.md"), "# Template docs")
+	writeFile(t, filepath.Join(src, "NOTES.md"), "Notes")
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), "{}")
+	writeFile(t, filepath.Join(src, ".devcontainer", "README.md"), "Applied")
+	writeFile(t, filepath.Join(src, ".github", "dependabot.yml"), "version: 2")
+	writeFile(t, filepath.Join(src, ".github", "workflows", "ci.yml"), "on: push")
+
+	tests := []struct {
+		name      string
+		omitPaths []string
+		want      []string
+		wantNot   []string
+	}{
+		{
+			name:    "whole tree",
+			want:    []string{".devcontainer/devcontainer.json", ".devcontainer/README.md", ".github/dependabot.yml", ".github/workflows/ci.yml"},
+			wantNot: []string{"devcontainer-template.json", "README.md", "NOTES.md"},
+		},
+		{
+			name:      "omitted optional path",
+			omitPaths: []string{".github/dependabot.yml"},
+			want:      []string{".devcontainer/devcontainer.json", ".github/workflows/ci.yml"},
+			wantNot:   []string{".github/dependabot.yml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := t.TempDir()
+			config := devctmpl.NewConfig()
+			config.OmitPaths = tt.omitPaths
+			if err := devctmpl.GenerateTemplateWithConfig(src, target, nil, config); err != nil {
+				t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+			}
+			for _, name := range tt.want {
+				if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+					t.Errorf("expected %s to be applied: %v", name, err)
+				}
+			}
+			for _, name := range tt.wantNot {
+				if _, err := os.Stat(filepath.Join(target, name)); !os.IsNotExist(err) {
+					t.Errorf("expected %s not to be applied, got err = %v", name, err)
+				}
+			}
+		})
+	}
+}
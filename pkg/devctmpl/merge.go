@@ -0,0 +1,211 @@
+package devctmpl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// Conflict markers written into text files that could not be merged
+const (
+	conflictStart = "<<<<<<< workspace\n"
+	conflictSep   = "=======\n"
+	conflictEnd   = ">>>>>>> template\n"
+)
+
+// mergeText merges the changes from base to theirs into ours line by line.
+// Overlapping changes are written with conflict markers, and the number of
+// conflicts is returned.
+func mergeText(base []byte, ours []byte, theirs []byte) ([]byte, int) {
+	baseLines, ourLines, theirLines := splitLines(base), splitLines(ours), splitLines(theirs)
+	ourMatch := matchLines(baseLines, ourLines)
+	theirMatch := matchLines(baseLines, theirLines)
+
+	var out bytes.Buffer
+	conflicts := 0
+	emit := func(b []string, o []string, t []string) {
+		switch {
+		case equalLines(o, t), equalLines(b, t):
+			writeLines(&out, o)
+		case equalLines(b, o):
+			writeLines(&out, t)
+		default:
+			conflicts++
+			out.WriteString(conflictStart)
+			writeTerminatedLines(&out, o)
+			out.WriteString(conflictSep)
+			writeTerminatedLines(&out, t)
+			out.WriteString(conflictEnd)
+		}
+	}
+
+	// Lines of base kept by both sides are stable; the chunks between them
+	// are merged as a whole
+	i, o, t := 0, 0, 0
+	for k := 0; k <= len(baseLines); k++ {
+		if k < len(baseLines) && (ourMatch[k] < 0 || theirMatch[k] < 0) {
+			continue
+		}
+		oEnd, tEnd := len(ourLines), len(theirLines)
+		if k < len(baseLines) {
+			oEnd, tEnd = ourMatch[k], theirMatch[k]
+		}
+		emit(baseLines[i:k], ourLines[o:oEnd], theirLines[t:tEnd])
+		if k < len(baseLines) {
+			out.WriteString(baseLines[k])
+		}
+		i, o, t = k+1, oEnd+1, tEnd+1
+	}
+	return out.Bytes(), conflicts
+}
+
+// matchLines returns for each line of base the index of the same line in
+// other, or -1 if it was removed
+func matchLines(base []string, other []string) []int {
+	match := make([]int, len(base))
+	i, j := 0, 0
+	for _, op := range diffLines(base, other) {
+		switch op.kind {
+		case ' ':
+			match[i] = j
+			i++
+			j++
+		case '-':
+			match[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+	return match
+}
+
+func equalLines(a []string, b []string) bool {
+	return strings.Join(a, "") == strings.Join(b, "")
+}
+
+func writeLines(w io.StringWriter, lines []string) {
+	for _, line := range lines {
+		w.WriteString(line)
+	}
+}
+
+// writeTerminatedLines writes lines making sure the last one ends in a
+// newline, so a conflict marker can follow
+func writeTerminatedLines(w io.StringWriter, lines []string) {
+	writeLines(w, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		w.WriteString("\n")
+	}
+}
+
+// mergeJSONC merges the changes from base to theirs into the JSONC document
+// ours member by member. The changes are edits of the workspace document, so
+// its comments and formatting are kept. Conflicting members keep the
+// workspace value and are returned as JSON pointers.
+func mergeJSONC(base []byte, ours []byte, theirs []byte) ([]byte, []string, error) {
+	baseDoc, err := jsonc.Parse(base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("previous template version: %w", err)
+	}
+	ourDoc, err := jsonc.Parse(ours)
+	if err != nil {
+		return nil, nil, fmt.Errorf("workspace: %w", err)
+	}
+	theirDoc, err := jsonc.Parse(theirs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new template version: %w", err)
+	}
+
+	// Edits replace the root of ourDoc, the nodes passed down stay as parsed
+	conflicts, err := mergeJSONNodes(ourDoc, "", baseDoc.Root, ourDoc.Root, theirDoc.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ourDoc.Bytes(), conflicts, nil
+}
+
+// mergeJSONNodes applies the changes from base to theirs at pointer to doc.
+// base is nil if the value did not exist.
+func mergeJSONNodes(doc *jsonc.Document, pointer string, base *jsonc.Node, ours *jsonc.Node, theirs *jsonc.Node) ([]string, error) {
+	switch {
+	case jsonEqual(ours, theirs), jsonEqual(base, theirs):
+		return nil, nil
+	case jsonEqual(base, ours):
+		return nil, doc.Set(pointer, json.RawMessage(theirs.Raw()))
+	}
+	if ours.Kind != jsonc.Object || theirs.Kind != jsonc.Object {
+		return []string{pointer}, nil
+	}
+
+	var conflicts []string
+	seen := make(map[string]bool)
+	for _, m := range append(append([]*jsonc.Member{}, ours.Members...), theirs.Members...) {
+		key := m.Key
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		b, o, t := memberValue(base, key), memberValue(ours, key), memberValue(theirs, key)
+		child := pointer + "/" + jsonc.EscapePointer(key)
+
+		var err error
+		switch {
+		case o == nil:
+			// Removed in the workspace, or added by the template
+			if b != nil && !jsonEqual(b, t) {
+				conflicts = append(conflicts, child)
+			} else if b == nil {
+				err = doc.Set(child, json.RawMessage(t.Raw()))
+			}
+		case t == nil:
+			// Removed by the template, or added in the workspace
+			if b != nil && !jsonEqual(b, o) {
+				conflicts = append(conflicts, child)
+			} else if b != nil {
+				err = doc.Delete(child)
+			}
+		default:
+			var childConflicts []string
+			childConflicts, err = mergeJSONNodes(doc, child, b, o, t)
+			conflicts = append(conflicts, childConflicts...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge %s: %w", child, err)
+		}
+	}
+	return conflicts, nil
+}
+
+// memberValue returns the value of the member key of an object node, or nil
+func memberValue(n *jsonc.Node, key string) *jsonc.Node {
+	if n == nil || n.Kind != jsonc.Object {
+		return nil
+	}
+	if m := n.Member(key); m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+// jsonEqual reports whether two values are equal, ignoring formatting and
+// comments. A nil node only equals another nil node.
+func jsonEqual(a *jsonc.Node, b *jsonc.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	av, err := a.Value()
+	if err != nil {
+		return false
+	}
+	bv, err := b.Value()
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
@@ -28,23 +30,30 @@ func isOCIRepository(source string) bool {
 	return err == nil
 }
 
-func pullOCITemplate(reference string, destDir string) error {
+// pullOCITemplate extracts the template image at reference into destDir and
+// returns its manifest digest
+func pullOCITemplate(reference string, destDir string) (string, error) {
 	// Parse the reference
 	ref, err := name.ParseReference(reference)
 	if err != nil {
-		return fmt.Errorf("invalid reference %q: %w", reference, err)
+		return "", fmt.Errorf("invalid reference %q: %w", reference, err)
 	}
 
 	// Pull the image
 	img, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
 	if err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+		return "", fmt.Errorf("failed to pull image: %w", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get image digest: %w", err)
 	}
 
 	// Get all layers
 	layers, err := img.Layers()
 	if err != nil {
-		return fmt.Errorf("failed to get layers: %w", err)
+		return "", fmt.Errorf("failed to get layers: %w", err)
 	}
 
 	// Extract each layer
@@ -52,17 +61,97 @@ func pullOCITemplate(reference string, destDir string) error {
 		// Get layer content
 		rc, err := layer.Uncompressed()
 		if err != nil {
-			return fmt.Errorf("failed to get layer content: %w", err)
+			return "", fmt.Errorf("failed to get layer content: %w", err)
 		}
 		defer rc.Close()
 
 		// Extract the layer
 		if err := extractTar(rc, destDir); err != nil {
-			return fmt.Errorf("failed to extract layer: %w", err)
+			return "", fmt.Errorf("failed to extract layer: %w", err)
 		}
 	}
 
-	return nil
+	return digest.String(), nil
+}
+
+// featureMetadataAnnotation is the manifest annotation holding the
+// devcontainer-feature.json of a published feature
+const featureMetadataAnnotation = "dev.containers.metadata"
+
+// pullOCIFeature returns the devcontainer-feature.json of the feature at
+// reference and its manifest digest
+func pullOCIFeature(reference string) ([]byte, string, error) {
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid reference %q: %w", reference, err)
+	}
+
+	img, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to pull feature: %w", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get feature digest: %w", err)
+	}
+
+	// Recent features carry their metadata in the manifest, older ones
+	// only in the layer
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get feature manifest: %w", err)
+	}
+	if metadata := manifest.Annotations[featureMetadataAnnotation]; metadata != "" {
+		return []byte(metadata), digest.String(), nil
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get layers: %w", err)
+	}
+	for _, layer := range layers {
+		data, err := readLayerFile(layer, "devcontainer-feature.json")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read layer: %w", err)
+		}
+		if data != nil {
+			return data, digest.String(), nil
+		}
+	}
+	return nil, "", fmt.Errorf("devcontainer-feature.json not found in feature %q", reference)
+}
+
+// readLayerFile returns the content of file in the layer, or nil if the
+// layer doesn't contain it
+func readLayerFile(layer v1.Layer, file string) ([]byte, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Clean(header.Name) == file {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// pinOCIReference returns reference pinned to the manifest digest
+func pinOCIReference(reference string, digest string) (string, error) {
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		return "", fmt.Errorf("invalid reference %q: %w", reference, err)
+	}
+	return ref.Context().Digest(digest).String(), nil
 }
 
 func extractTar(r io.Reader, dest string) error {
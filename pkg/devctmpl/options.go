@@ -0,0 +1,83 @@
+package devctmpl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// resolveOptions returns the provided options completed with the template
+// defaults. A default may reference other options with ${templateOption:key},
+// e.g. "${templateOption:version}-${templateOption:variant}". Provided values
+// are used literally, defaults are resolved in dependency order.
+func resolveOptions(template *DevContainerTemplate, options map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(template.Options))
+	for name, value := range options {
+		resolved[name] = value
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(template.Options))
+	var stack []string
+
+	var resolve func(name string) error
+	resolve = func(name string) error {
+		if _, provided := options[name]; provided || state[name] == done {
+			return nil
+		}
+		if state[name] == visiting {
+			start := 0
+			for i, n := range stack {
+				if n == name {
+					start = i
+				}
+			}
+			cycle := append(stack[start:], name)
+			return fmt.Errorf("cycle in option defaults: %s", strings.Join(cycle, " -> "))
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+
+		def := template.Options[name].Default
+		for _, ref := range optionVarRegex.FindAllStringSubmatch(def, -1) {
+			if ref[2] != "" {
+				return fmt.Errorf("default of option '%s' uses filter '%s', filters are not supported in defaults", name, ref[2])
+			}
+			if _, exists := template.Options[ref[1]]; !exists {
+				return fmt.Errorf("default of option '%s' references unknown option '%s'", name, ref[1])
+			}
+			if err := resolve(ref[1]); err != nil {
+				return err
+			}
+		}
+
+		// Options without a value expand to an empty string
+		if def != "" {
+			resolved[name] = optionVarRegex.ReplaceAllStringFunc(def, func(match string) string {
+				return resolved[optionVarRegex.FindStringSubmatch(match)[1]]
+			})
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		return nil
+	}
+
+	names := make([]string, 0, len(template.Options))
+	for name := range template.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,234 @@
+package devctmpl
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveModTime is the modification time of archived files, fixed so
+// archives of the same template are identical
+var archiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// OutputTarget receives the files of a rendered template
+type OutputTarget interface {
+	// WriteFile writes a file at the slash separated path name, relative to
+	// the root of the output
+	WriteFile(name string, mode fs.FileMode, content []byte) error
+	// Close completes the output. It doesn't close the underlying writer.
+	Close() error
+}
+
+// OutputFormat is the kind of an OutputTarget
+type OutputFormat string
+
+const (
+	OutputDir   OutputFormat = "dir"
+	OutputTar   OutputFormat = "tar"
+	OutputTarGz OutputFormat = "tar.gz"
+	OutputZip   OutputFormat = "zip"
+)
+
+// OutputFormatFor returns the format of an output path by its extension,
+// OutputDir for paths without an archive extension
+func OutputFormatFor(path string) OutputFormat {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return OutputTarGz
+	case strings.HasSuffix(lower, ".tar"):
+		return OutputTar
+	case strings.HasSuffix(lower, ".zip"):
+		return OutputZip
+	default:
+		return OutputDir
+	}
+}
+
+// NewArchiveOutput creates a tar, tar.gz or zip OutputTarget writing to w
+func NewArchiveOutput(format OutputFormat, w io.Writer) (OutputTarget, error) {
+	switch format {
+	case OutputTar:
+		return NewTarOutput(w), nil
+	case OutputTarGz:
+		return NewTarGzOutput(w), nil
+	case OutputZip:
+		return NewZipOutput(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format '%s' (supported formats: %s, %s, %s)", format, OutputTar, OutputTarGz, OutputZip)
+	}
+}
+
+// GenerateTemplateToOutput renders a template like GenerateTemplateWithContext
+// and writes its files to out instead of a workspace. No template state is
+// recorded and no conflicts are checked. The caller must Close out.
+func GenerateTemplateToOutput(ctx context.Context, source string, options map[string]string, cfg Config, out OutputTarget) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rendered, err := renderTemplate(source, options, cfg)
+	if err != nil {
+		return err
+	}
+	defer rendered.cleanup()
+
+	return writeOutput(ctx, rendered.dir, out)
+}
+
+// writeOutput writes the regular files of dir to out in lexical order
+func writeOutput(ctx context.Context, dir string, out OutputTarget) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := out.WriteFile(filepath.ToSlash(rel), info.Mode().Perm(), content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filepath.ToSlash(rel), err)
+		}
+		return nil
+	})
+}
+
+// dirOutput writes files to a directory
+type dirOutput struct {
+	dir string
+}
+
+// NewDirOutput creates an OutputTarget writing files to dir, overwriting
+// existing files
+func NewDirOutput(dir string) OutputTarget {
+	return &dirOutput{dir: dir}
+}
+
+func (o *dirOutput) WriteFile(name string, mode fs.FileMode, content []byte) error {
+	path := filepath.Join(o.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, mode)
+}
+
+func (o *dirOutput) Close() error {
+	return nil
+}
+
+// tarOutput writes files to a tar archive, optionally gzip compressed
+type tarOutput struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+// NewTarOutput creates an OutputTarget writing a tar archive to w
+func NewTarOutput(w io.Writer) OutputTarget {
+	return &tarOutput{tw: tar.NewWriter(w)}
+}
+
+// NewTarGzOutput creates an OutputTarget writing a gzip compressed tar
+// archive to w
+func NewTarGzOutput(w io.Writer) OutputTarget {
+	gz := gzip.NewWriter(w)
+	return &tarOutput{tw: tar.NewWriter(gz), gz: gz}
+}
+
+func (o *tarOutput) WriteFile(name string, mode fs.FileMode, content []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(content)),
+		ModTime:  archiveModTime,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	}
+	if err := o.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := o.tw.Write(content)
+	return err
+}
+
+func (o *tarOutput) Close() error {
+	if err := o.tw.Close(); err != nil {
+		return err
+	}
+	if o.gz != nil {
+		return o.gz.Close()
+	}
+	return nil
+}
+
+// zipOutput writes files to a zip archive
+type zipOutput struct {
+	zw *zip.Writer
+}
+
+// NewZipOutput creates an OutputTarget writing a zip archive to w
+func NewZipOutput(w io.Writer) OutputTarget {
+	return &zipOutput{zw: zip.NewWriter(w)}
+}
+
+func (o *zipOutput) WriteFile(name string, mode fs.FileMode, content []byte) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archiveModTime}
+	header.SetMode(mode.Perm())
+	w, err := o.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func (o *zipOutput) Close() error {
+	return o.zw.Close()
+}
+
+// MemoryFile is a file written to a MemoryOutput
+type MemoryFile struct {
+	Mode    fs.FileMode
+	Content []byte
+}
+
+// MemoryOutput is an OutputTarget keeping the files in memory
+type MemoryOutput struct {
+	mu sync.Mutex
+	// Files maps slash separated paths to the files written
+	Files map[string]MemoryFile
+}
+
+// NewMemoryOutput creates an empty MemoryOutput
+func NewMemoryOutput() *MemoryOutput {
+	return &MemoryOutput{Files: make(map[string]MemoryFile)}
+}
+
+func (o *MemoryOutput) WriteFile(name string, mode fs.FileMode, content []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.Files[name] = MemoryFile{Mode: mode, Content: append([]byte(nil), content...)}
+	return nil
+}
+
+func (o *MemoryOutput) Close() error {
+	return nil
+}
@@ -0,0 +1,181 @@
+package devctmpl_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+// readTar returns the files of a tar archive
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+}
+
+func TestGenerateTemplateToOutput(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "output", "version": "1.0.0", "name": "Output",
+		"options": {"variant": {"type": "string", "description": "Variant", "default": "1.22"}}
+	}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), `{"image": "go:${templateOption:variant}"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "scripts", "setup.sh"), "#!/bin/sh\n")
+	want := map[string]string{
+		".devcontainer/devcontainer.json": `{"image": "go:1.22"}`,
+		".devcontainer/scripts/setup.sh":  "#!/bin/sh\n",
+	}
+
+	tests := []struct {
+		format devctmpl.OutputFormat
+		read   func(t *testing.T, data []byte) map[string]string
+	}{
+		{
+			format: devctmpl.OutputTar,
+			read: func(t *testing.T, data []byte) map[string]string {
+				return readTar(t, bytes.NewReader(data))
+			},
+		},
+		{
+			format: devctmpl.OutputTarGz,
+			read: func(t *testing.T, data []byte) map[string]string {
+				gz, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return readTar(t, gz)
+			},
+		},
+		{
+			format: devctmpl.OutputZip,
+			read: func(t *testing.T, data []byte) map[string]string {
+				zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				files := make(map[string]string)
+				for _, f := range zr.File {
+					rc, err := f.Open()
+					if err != nil {
+						t.Fatal(err)
+					}
+					content, err := io.ReadAll(rc)
+					rc.Close()
+					if err != nil {
+						t.Fatal(err)
+					}
+					files[f.Name] = string(content)
+				}
+				return files
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			out, err := devctmpl.NewArchiveOutput(tt.format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := devctmpl.GenerateTemplateToOutput(context.Background(), src, nil, devctmpl.NewConfig(), out); err != nil {
+				t.Fatalf("GenerateTemplateToOutput() error = %v", err)
+			}
+			if err := out.Close(); err != nil {
+				t.Fatal(err)
+			}
+			first := buf.Bytes()
+
+			got := tt.read(t, first)
+			if len(got) != len(want) {
+				t.Errorf("archive files = %v, want %v", got, want)
+			}
+			for name, content := range want {
+				if got[name] != content {
+					t.Errorf("%s = %q, want %q", name, got[name], content)
+				}
+			}
+
+			// Archives are reproducible
+			var again bytes.Buffer
+			out, _ = devctmpl.NewArchiveOutput(tt.format, &again)
+			if err := devctmpl.GenerateTemplateToOutput(context.Background(), src, nil, devctmpl.NewConfig(), out); err != nil {
+				t.Fatal(err)
+			}
+			out.Close()
+			if !bytes.Equal(first, again.Bytes()) {
+				t.Errorf("archives of the same template differ")
+			}
+		})
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		out := devctmpl.NewMemoryOutput()
+		config := devctmpl.NewConfig()
+		config.TargetSubdir = "services/api"
+		if err := devctmpl.GenerateTemplateToOutput(context.Background(), src, map[string]string{"variant": "1.23"}, config, out); err != nil {
+			t.Fatalf("GenerateTemplateToOutput() error = %v", err)
+		}
+		file, ok := out.Files["services/api/.devcontainer/scripts/setup.sh"]
+		if !ok || string(file.Content) != "#!/bin/sh\n" {
+			t.Errorf("memory files = %v, want setup.sh in services/api", out.Files)
+		}
+		if _, ok := out.Files["services/api/.devcontainer/devcontainer.json"]; !ok {
+			t.Errorf("memory files = %v, want devcontainer.json in services/api", out.Files)
+		}
+	})
+
+	t.Run("dir", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := devctmpl.GenerateTemplateToOutput(context.Background(), src, nil, devctmpl.NewConfig(), devctmpl.NewDirOutput(dir)); err != nil {
+			t.Fatalf("GenerateTemplateToOutput() error = %v", err)
+		}
+		for name, content := range want {
+			got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil || string(got) != content {
+				t.Errorf("%s = %q, %v, want %q", name, got, err, content)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, devctmpl.StateDir)); !os.IsNotExist(err) {
+			t.Errorf("expected no template state in output, got err = %v", err)
+		}
+	})
+}
+
+func TestOutputFormatFor(t *testing.T) {
+	tests := map[string]devctmpl.OutputFormat{
+		"out.tar":    devctmpl.OutputTar,
+		"out.tar.gz": devctmpl.OutputTarGz,
+		"OUT.TGZ":    devctmpl.OutputTarGz,
+		"out.zip":    devctmpl.OutputZip,
+		"out":        devctmpl.OutputDir,
+		"out.d/":     devctmpl.OutputDir,
+	}
+	for path, want := range tests {
+		if got := devctmpl.OutputFormatFor(path); got != want {
+			t.Errorf("OutputFormatFor(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package devctmpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileAction is what applying a template does to a file
+type FileAction string
+
+const (
+	ActionCreate    FileAction = "created"
+	ActionModify    FileAction = "modified"
+	ActionUnchanged FileAction = "unchanged"
+	ActionSkip      FileAction = "skipped"
+	// ActionMerge, ActionConflict and ActionDelete are used by upgrades
+	// and reverts. ActionConflict also marks files a template can't be
+	// applied over with ConflictFail.
+	ActionMerge    FileAction = "merged"
+	ActionConflict FileAction = "conflict"
+	ActionDelete   FileAction = "deleted"
+	ActionRestore  FileAction = "restored"
+)
+
+// PlannedFile is a single file of a Plan
+type PlannedFile struct {
+	// Path is the slash separated path relative to the target directory
+	Path   string     `json:"path"`
+	Action FileAction `json:"action"`
+	// Reason explains skipped and conflicting files
+	Reason string `json:"reason,omitempty"`
+	// Diff is a unified diff of the change for modified files
+	Diff string `json:"diff,omitempty"`
+}
+
+// Plan describes the changes applying a template would make to a target
+// directory
+type Plan struct {
+	Template string        `json:"template"`
+	Target   string        `json:"target"`
+	Files    []PlannedFile `json:"files"`
+}
+
+// PlanTemplate renders the template like GenerateTemplateWithConfig but
+// leaves the target directory untouched, returning the changes it would make.
+// Modified files are resolved by cfg.OnConflict: with ConflictFail they are
+// reported as ActionConflict, and applying the template would fail.
+func PlanTemplate(source string, target string, options map[string]string, cfg Config) (*Plan, error) {
+	if err := cfg.OnConflict.validate(); err != nil {
+		return nil, err
+	}
+	rendered, err := renderTemplate(source, options, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer rendered.cleanup()
+
+	plan, err := buildPlan(rendered, target)
+	if err != nil {
+		return nil, err
+	}
+	if err := planConflicts(plan, target, cfg.OnConflict); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planConflicts updates the modified files of plan to what applying it with
+// policy would do, like resolveConflict
+func planConflicts(plan *Plan, target string, policy ConflictPolicy) error {
+	var backups []PlannedFile
+	for i, file := range plan.Files {
+		if file.Action != ActionModify {
+			continue
+		}
+		switch policy {
+		case ConflictFail, "":
+			plan.Files[i].Action = ActionConflict
+			plan.Files[i].Reason = "exists and differs from the template"
+		case ConflictSkip:
+			plan.Files[i].Action = ActionSkip
+			plan.Files[i].Reason = "exists and differs from the template"
+			plan.Files[i].Diff = ""
+		case ConflictBackup:
+			backup, err := backupPath(filepath.Join(target, filepath.FromSlash(file.Path)))
+			if err != nil {
+				return err
+			}
+			backupRel := path.Join(path.Dir(file.Path), filepath.Base(backup))
+			plan.Files[i].Reason = "backed up to " + backupRel
+			backups = append(backups, PlannedFile{Path: backupRel, Action: ActionCreate, Reason: "backup of " + file.Path})
+		case ConflictPrompt:
+			plan.Files[i].Reason = "asks before overwriting"
+		}
+	}
+	if len(backups) > 0 {
+		plan.Files = append(plan.Files, backups...)
+		sort.SliceStable(plan.Files, func(i, j int) bool { return plan.Files[i].Path < plan.Files[j].Path })
+	}
+	return nil
+}
+
+func buildPlan(rendered *renderedTemplate, target string) (*Plan, error) {
+	plan := &Plan{Template: rendered.template.ID, Target: target, Files: []PlannedFile{}}
+
+	err := filepath.WalkDir(rendered.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(rendered.dir, path)
+		if err != nil {
+			return err
+		}
+		file, err := planFile(path, filepath.Join(target, rel), filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		plan.Files = append(plan.Files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare template with target directory: %w", err)
+	}
+
+	for _, path := range rendered.omitted {
+		plan.Files = append(plan.Files, PlannedFile{Path: path, Action: ActionSkip, Reason: "omitted"})
+	}
+	sort.SliceStable(plan.Files, func(i, j int) bool { return plan.Files[i].Path < plan.Files[j].Path })
+
+	return plan, nil
+}
+
+func planFile(renderedPath string, targetPath string, rel string) (PlannedFile, error) {
+	file := PlannedFile{Path: rel}
+	rendered, err := os.ReadFile(renderedPath)
+	if err != nil {
+		return file, err
+	}
+	existing, err := os.ReadFile(targetPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		file.Action = ActionCreate
+	case err != nil:
+		return file, err
+	case bytes.Equal(existing, rendered):
+		file.Action = ActionUnchanged
+	default:
+		file.Action = ActionModify
+		file.Diff = unifiedDiff("a/"+rel, "b/"+rel, existing, rendered)
+	}
+	return file, nil
+}
+
+// Count returns the number of planned files with the given action
+func (p *Plan) Count(action FileAction) int {
+	n := 0
+	for _, file := range p.Files {
+		if file.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// WritePlan writes the plan in text or JSON format. Diffs of modified files
+// are included if withDiff is set.
+func WritePlan(w io.Writer, format ReportFormat, plan *Plan, withDiff bool) error {
+	switch format {
+	case FormatText, "":
+		return writePlanText(w, plan, withDiff)
+	case FormatJSON:
+		if !withDiff {
+			stripped := *plan
+			stripped.Files = make([]PlannedFile, len(plan.Files))
+			for i, file := range plan.Files {
+				file.Diff = ""
+				stripped.Files[i] = file
+			}
+			plan = &stripped
+		}
+		return writeJSON(w, plan)
+	default:
+		return fmt.Errorf("unsupported plan format '%s' (supported formats: text, json)", format)
+	}
+}
+
+func writePlanText(w io.Writer, plan *Plan, withDiff bool) error {
+	for _, file := range plan.Files {
+		line := fmt.Sprintf("%-9s %s", file.Action, file.Path)
+		if file.Reason != "" {
+			line += " (" + file.Reason + ")"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if withDiff && file.Diff != "" {
+			if _, err := io.WriteString(w, file.Diff); err != nil {
+				return err
+			}
+		}
+	}
+	var counts []string
+	for _, action := range []FileAction{ActionCreate, ActionModify, ActionMerge, ActionConflict, ActionRestore, ActionDelete, ActionUnchanged, ActionSkip} {
+		if n := plan.Count(action); n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, action))
+		}
+	}
+	summary := "no files"
+	if len(counts) > 0 {
+		summary = strings.Join(counts, ", ")
+	}
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
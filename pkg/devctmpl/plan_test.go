@@ -0,0 +1,157 @@
+package devctmpl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestPlanTemplate(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "plan", "version": "1.0.0", "name": "Plan", "optionalPaths": ["docs/"]}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), "{\n  \"name\": \"plan\",\n  \"image\": \"debian:12\"\n}\n")
+	writeFile(t, filepath.Join(src, ".devcontainer/Dockerfile"), "FROM debian:12\n")
+	writeFile(t, filepath.Join(src, "new.txt"), "new\n")
+	writeFile(t, filepath.Join(src, "docs/skip.md"), "skip\n")
+
+	target := t.TempDir()
+	writeFile(t, filepath.Join(target, ".devcontainer/devcontainer.json"), "{\n  \"name\": \"plan\",\n  \"image\": \"debian:11\"\n}\n")
+	writeFile(t, filepath.Join(target, ".devcontainer/Dockerfile"), "FROM debian:12\n")
+
+	cfg := devctmpl.NewConfig()
+	cfg.OmitPaths = []string{"docs/"}
+	cfg.OnConflict = devctmpl.ConflictOverwrite
+	plan, err := devctmpl.PlanTemplate(src, target, nil, cfg)
+	if err != nil {
+		t.Fatalf("PlanTemplate() error = %v", err)
+	}
+
+	got := make(map[string]devctmpl.FileAction)
+	for _, file := range plan.Files {
+		got[file.Path] = file.Action
+	}
+	want := map[string]devctmpl.FileAction{
+		".devcontainer/Dockerfile":        devctmpl.ActionUnchanged,
+		".devcontainer/devcontainer.json": devctmpl.ActionModify,
+		"docs/skip.md":                    devctmpl.ActionSkip,
+		"new.txt":                         devctmpl.ActionCreate,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("plan files = %v, want %v", got, want)
+	}
+	for path, action := range want {
+		if got[path] != action {
+			t.Errorf("action of %s = %q, want %q", path, got[path], action)
+		}
+	}
+
+	// The target directory must not be touched
+	if _, err := os.Stat(filepath.Join(target, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("dry run created new.txt in target directory")
+	}
+
+	var text bytes.Buffer
+	if err := devctmpl.WritePlan(&text, devctmpl.FormatText, plan, true); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+	wantDiff := `--- a/.devcontainer/devcontainer.json
++++ b/.devcontainer/devcontainer.json
+@@ -1,4 +1,4 @@
+ {
+   "name": "plan",
+-  "image": "debian:11"
++  "image": "debian:12"
+ }
+`
+	for _, s := range []string{wantDiff, "skipped   docs/skip.md (omitted)", "1 created, 1 modified, 1 unchanged, 1 skipped"} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("text plan does not contain %q:\n%s", s, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := devctmpl.WritePlan(&out, devctmpl.FormatJSON, plan, false); err != nil {
+		t.Fatalf("WritePlan() error = %v", err)
+	}
+	var decoded devctmpl.Plan
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON plan: %v", err)
+	}
+	if decoded.Template != "plan" || len(decoded.Files) != 4 {
+		t.Errorf("JSON plan = %+v", decoded)
+	}
+	for _, file := range decoded.Files {
+		if file.Diff != "" {
+			t.Errorf("JSON plan without diffs contains diff for %s", file.Path)
+		}
+	}
+}
+
+func TestPlanTemplateConflictPolicy(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "plan", "version": "1.0.0", "name": "Plan"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer.json"), `{"image": "debian:12"}`)
+
+	tests := []struct {
+		policy devctmpl.ConflictPolicy
+		want   []devctmpl.PlannedFile
+	}{
+		{
+			policy: devctmpl.ConflictFail,
+			want:   []devctmpl.PlannedFile{{Path: ".devcontainer.json", Action: devctmpl.ActionConflict, Reason: "exists and differs from the template"}},
+		},
+		{
+			policy: devctmpl.ConflictSkip,
+			want:   []devctmpl.PlannedFile{{Path: ".devcontainer.json", Action: devctmpl.ActionSkip, Reason: "exists and differs from the template"}},
+		},
+		{
+			policy: devctmpl.ConflictOverwrite,
+			want:   []devctmpl.PlannedFile{{Path: ".devcontainer.json", Action: devctmpl.ActionModify}},
+		},
+		{
+			// .devcontainer.json.orig is taken by an earlier backup
+			policy: devctmpl.ConflictBackup,
+			want: []devctmpl.PlannedFile{
+				{Path: ".devcontainer.json", Action: devctmpl.ActionModify, Reason: "backed up to .devcontainer.json.orig.1"},
+				{Path: ".devcontainer.json.orig.1", Action: devctmpl.ActionCreate, Reason: "backup of .devcontainer.json"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			target := t.TempDir()
+			writeFile(t, filepath.Join(target, ".devcontainer.json"), `{"image": "debian:11"}`)
+			writeFile(t, filepath.Join(target, ".devcontainer.json.orig"), `{"image": "debian:10"}`)
+
+			cfg := devctmpl.NewConfig()
+			cfg.OnConflict = tt.policy
+			plan, err := devctmpl.PlanTemplate(src, target, nil, cfg)
+			if err != nil {
+				t.Fatalf("PlanTemplate() error = %v", err)
+			}
+			if len(plan.Files) != len(tt.want) {
+				t.Fatalf("plan files = %+v, want %+v", plan.Files, tt.want)
+			}
+			for i, want := range tt.want {
+				got := plan.Files[i]
+				if got.Path != want.Path || got.Action != want.Action || got.Reason != want.Reason {
+					t.Errorf("plan file %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		cfg := devctmpl.NewConfig()
+		cfg.OnConflict = "merge"
+		if _, err := devctmpl.PlanTemplate(src, t.TempDir(), nil, cfg); err == nil {
+			t.Errorf("PlanTemplate() with unsupported policy succeeded")
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package devctmpl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// goTemplateSuffix marks files that are rendered with text/template
+const goTemplateSuffix = ".tmpl"
+
+// templateFuncs is the helper function set available in .tmpl files.
+// It intentionally contains no functions that touch the environment.
+var templateFuncs = template.FuncMap{
+	"default": defaultValue,
+	"join":    joinValues,
+	"toJson":  toJSON,
+	"quote":   func(v any) string { return strconv.Quote(fmt.Sprint(v)) },
+	"lower":   func(v any) string { return strings.ToLower(fmt.Sprint(v)) },
+	"upper":   func(v any) string { return strings.ToUpper(fmt.Sprint(v)) },
+}
+
+// defaultValue returns def when v is nil or an empty string
+func defaultValue(def any, v any) any {
+	if v == nil {
+		return def
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return def
+	}
+	return v
+}
+
+// joinValues joins the elements of a list with sep
+func joinValues(sep string, v any) (string, error) {
+	switch list := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return list, nil
+	case []string:
+		return strings.Join(list, sep), nil
+	case []any:
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, sep), nil
+	default:
+		return "", fmt.Errorf("join: unsupported type %T", v)
+	}
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// typedOptions converts option values to the types declared in the template,
+// so boolean options can be used directly in conditionals. Values that don't
+// parse are kept as strings and reported by schema validation.
+func typedOptions(tmpl *DevContainerTemplate, options map[string]string) map[string]any {
+	data := make(map[string]any, len(options))
+	for name, value := range options {
+		data[name] = value
+		if optDef, ok := tmpl.Options[name]; ok && optDef.Type == "boolean" {
+			if b, err := strconv.ParseBool(value); err == nil {
+				data[name] = b
+			}
+		}
+	}
+	return data
+}
+
+// renderGoTemplates renders every *.tmpl file in dir with text/template and
+// writes the result next to it with the suffix stripped. Files excluded from
+// substitution are copied as is.
+func renderGoTemplates(dir string, tmpl *DevContainerTemplate, options map[string]string, exclude *pathMatcher) error {
+	data := typedOptions(tmpl, options)
+
+	var paths []string
+	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, goTemplateSuffix) && !exclude.match(path, false) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := renderGoTemplate(dir, path, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderGoTemplate(dir string, path string, data map[string]any) error {
+	srcPath := filepath.Join(dir, path)
+	dstPath := strings.TrimSuffix(srcPath, goTemplateSuffix)
+
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("both %s and %s exist in template", strings.TrimSuffix(path, goTemplateSuffix), path)
+	}
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat file %s: %w", path, err)
+	}
+
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+
+	// The template is named after its path so that parse and execution
+	// errors read "template: <path>:<line>: ...". Options that don't exist
+	// are errors instead of rendering "<no value>".
+	t, err := template.New(path).Option("missingkey=error").Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	if err := os.WriteFile(dstPath, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", dstPath, err)
+	}
+	if err := os.Remove(srcPath); err != nil {
+		return fmt.Errorf("failed to remove file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package devctmpl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestGenerateTemplateGoTemplates(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     map[string]string
+		wantContain []string
+		wantMissing []string
+		wantErr     bool
+	}{
+		{
+			name:        "defaults",
+			options:     map[string]string{},
+			wantContain: []string{`"name": "Java"`, "java:1-bookworm", "features/java:1"},
+			wantMissing: []string{"maven", "gradle"},
+		},
+		{
+			name:        "enabled tools",
+			options:     map[string]string{"installMaven": "true", "imageVariant": "BULLSEYE"},
+			wantContain: []string{"features/maven:1", "java:1-bullseye"},
+			wantMissing: []string{"gradle"},
+		},
+		{
+			name:    "invalid boolean",
+			options: map[string]string{"installMaven": "maybe"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := filepath.Abs("testdata/tmpl_template")
+			if err != nil {
+				t.Fatalf("failed to get absolute path: %v", err)
+			}
+			tempDir := t.TempDir()
+			err = devctmpl.GenerateTemplate(dir, tempDir, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if _, err := os.Stat(filepath.Join(tempDir, ".devcontainer", "devcontainer.json.tmpl")); !os.IsNotExist(err) {
+				t.Errorf("expected .tmpl file to be removed from output, got err = %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(tempDir, ".devcontainer", "devcontainer.json"))
+			if err != nil {
+				t.Fatalf("failed to read rendered file: %v", err)
+			}
+			for _, want := range tt.wantContain {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("rendered file does not contain %q:\n%s", want, content)
+				}
+			}
+			for _, missing := range tt.wantMissing {
+				if strings.Contains(string(content), missing) {
+					t.Errorf("rendered file unexpectedly contains %q:\n%s", missing, content)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateGoTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "unknown function",
+			template: "{\n\t\"name\": \"{{ .name | nosuchfunc }}\"\n}\n",
+			want:     ".devcontainer/devcontainer.json.tmpl:2",
+		},
+		{
+			name:     "unknown option",
+			template: "{\n\t\"name\": \"{{ .name }}\"\n}\n",
+			want:     `.devcontainer/devcontainer.json.tmpl:2:13: executing ".devcontainer/devcontainer.json.tmpl" at <.name>: map has no entry for key "name"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "broken", "version": "1.0.0", "name": "Broken"}`)
+			writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json.tmpl"), tt.template)
+
+			err := devctmpl.GenerateTemplate(src, t.TempDir(), map[string]string{})
+			if err == nil {
+				t.Fatal("expected error for invalid template")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error does not point to template file and line: %v", err)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
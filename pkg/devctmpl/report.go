@@ -0,0 +1,201 @@
+package devctmpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Severity is the severity of an Issue
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// Issue is a single finding of a check, optionally located in a file
+type Issue struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+}
+
+func (i Issue) String() string {
+	location := ""
+	if i.File != "" {
+		location = i.File + ": "
+		if i.Line > 0 {
+			location = fmt.Sprintf("%s:%d: ", i.File, i.Line)
+		}
+	}
+	return fmt.Sprintf("%s%s: %s [%s]", location, i.Severity, i.Message, i.Rule)
+}
+
+// Rule describes a check that produces issues
+type Rule struct {
+	ID          string
+	Description string
+}
+
+// ReportFormat is the output format of WriteReport
+type ReportFormat string
+
+const (
+	FormatText  ReportFormat = "text"
+	FormatJSON  ReportFormat = "json"
+	FormatSARIF ReportFormat = "sarif"
+)
+
+// HasErrors reports whether any of the issues has error severity
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteReport writes issues in the given format. rules describe the checks
+// that were run and are included in SARIF output.
+func WriteReport(w io.Writer, format ReportFormat, rules []Rule, issues []Issue) error {
+	switch format {
+	case FormatText, "":
+		for _, issue := range issues {
+			if _, err := fmt.Fprintln(w, issue); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatJSON:
+		if issues == nil {
+			issues = []Issue{}
+		}
+		return writeJSON(w, issues)
+	case FormatSARIF:
+		return writeJSON(w, newSARIFLog(rules, issues))
+	default:
+		return fmt.Errorf("unsupported report format '%s' (supported formats: text, json, sarif)", format)
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// SARIF 2.1.0 structures, limited to what code scanning tools need
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func newSARIFLog(rules []Rule, issues []Issue) sarifLog {
+	driver := sarifDriver{
+		Name:           "devctmpl",
+		InformationURI: "https://github.com/mazurov/devcontainer-template",
+		Rules:          make([]sarifRule, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               rule.ID,
+			ShortDescription: sarifMessage{Text: rule.Description},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(issues))
+	for _, issue := range issues {
+		result := sarifResult{
+			RuleID:  issue.Rule,
+			Level:   string(issue.Severity),
+			Message: sarifMessage{Text: issue.Message},
+		}
+		if issue.File != "" {
+			location := sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: sarifURI(issue.File)},
+				},
+			}
+			if issue.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: issue.Line}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		results = append(results, result)
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: results,
+		}},
+	}
+}
+
+// sarifURI converts a file path to a SARIF artifact URI. Relative paths are
+// kept relative so code scanning resolves them against the repository root.
+func sarifURI(path string) string {
+	path = filepath.ToSlash(path)
+	if filepath.IsAbs(path) {
+		return "file://" + path
+	}
+	return strings.TrimPrefix(path, "./")
+}
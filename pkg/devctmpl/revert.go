@@ -0,0 +1,150 @@
+package devctmpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrWorkspaceChanged is returned by RevertTemplate if files written by the
+// template were changed afterwards
+var ErrWorkspaceChanged = errors.New("files were changed after the template was applied")
+
+// RevertTemplate restores workspace to its state before the template was
+// first applied: created files are deleted, overwritten files are restored
+// from the backup in the state directory and created directories are removed
+// if they are empty. If files were edited after the template was applied it
+// refuses with ErrWorkspaceChanged and a plan holding their diffs, unless
+// force is set.
+func RevertTemplate(workspace string, force bool) (*Plan, error) {
+	return RevertTemplateWithConfig(workspace, force, Config{})
+}
+
+// RevertTemplateWithConfig reverts like RevertTemplate the template applied
+// to cfg.TargetSubdir of workspace, as the sub-configuration cfg.AsConfig if
+// set
+func RevertTemplateWithConfig(workspace string, force bool, cfg Config) (*Plan, error) {
+	return RevertTemplateWithContext(context.Background(), workspace, force, cfg)
+}
+
+// RevertTemplateWithContext is RevertTemplateWithConfig with a context. The
+// workspace is changed in a transaction: if reverting fails or ctx is
+// cancelled, the changes made so far are rolled back.
+func RevertTemplateWithContext(ctx context.Context, workspace string, force bool, cfg Config) (plan *Plan, err error) {
+	dir, err := stateDir(cfg.TargetSubdir, cfg.AsConfig)
+	if err != nil {
+		return nil, err
+	}
+	state, err := ReadTargetState(workspace, cfg.TargetSubdir, cfg.AsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if len(state.Applied) == 0 {
+		return nil, fmt.Errorf("no files written by the template are recorded in '%s'", workspace)
+	}
+
+	plan = &Plan{Template: state.TemplateID, Target: workspace, Files: []PlannedFile{}}
+	var changed []string
+	for _, rel := range slices.Sorted(maps.Keys(state.Applied)) {
+		applied := state.Applied[rel]
+		current, exists, err := readOptionalFile(filepath.Join(workspace, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+
+		file := PlannedFile{Path: rel, Action: ActionRestore}
+		if applied.Created {
+			file.Action = ActionDelete
+			if !exists {
+				file.Action = ActionUnchanged
+			}
+		}
+		if exists != (applied.Hash != "") || (exists && hashBytes(current) != applied.Hash) {
+			written, _, err := readOptionalFile(filepath.Join(workspace, filepath.FromSlash(dir), appliedDirName, filepath.FromSlash(rel)))
+			if err != nil {
+				return nil, err
+			}
+			file.Reason = "changed after the template was applied"
+			file.Diff = unifiedDiff("applied/"+rel, "workspace/"+rel, written, current)
+			changed = append(changed, rel)
+		}
+		plan.Files = append(plan.Files, file)
+	}
+
+	if len(changed) > 0 && !force {
+		for i, file := range plan.Files {
+			if file.Reason != "" {
+				plan.Files[i].Action = ActionConflict
+			}
+		}
+		return plan, fmt.Errorf("%w: %s", ErrWorkspaceChanged, strings.Join(changed, ", "))
+	}
+
+	tx, err := beginTransaction(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.rollback(); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+		}
+	}()
+
+	for _, file := range plan.Files {
+		switch file.Action {
+		case ActionDelete:
+			if err := tx.remove(file.Path); err != nil {
+				return nil, err
+			}
+		case ActionRestore:
+			backup := filepath.Join(workspace, filepath.FromSlash(dir), backupDirName, filepath.FromSlash(file.Path))
+			if err := tx.copyFile(backup, file.Path); err != nil {
+				return nil, fmt.Errorf("failed to restore '%s': %w", file.Path, err)
+			}
+		}
+	}
+
+	if err := removeStateDir(tx, dir); err != nil {
+		return nil, fmt.Errorf("failed to remove state directory: %w", err)
+	}
+
+	// Remove created directories, deepest first, unless something else was
+	// put into them
+	for i := len(state.Dirs) - 1; i >= 0; i-- {
+		if _, err := tx.removeEmptyDir(state.Dirs[i]); err != nil {
+			return nil, err
+		}
+	}
+	tx.commit()
+	return plan, nil
+}
+
+// removeStateDir removes the state directory dir in the workspace of tx. The
+// states of templates applied as sub-configurations, nested in it, are kept.
+// Parents of dir inside the state directory are removed if they are empty.
+func removeStateDir(tx *transaction, dir string) error {
+	for _, name := range []string{stateFileName, backupDirName, appliedDirName} {
+		if err := tx.remove(path.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	// dir is StateDir or nested in it
+	for {
+		removed, err := tx.removeEmptyDir(dir)
+		if err != nil {
+			return err
+		}
+		// Not removed if it still holds the states of other templates
+		if !removed || path.Base(dir) == StateDir {
+			return nil
+		}
+		dir = path.Dir(dir)
+	}
+}
@@ -0,0 +1,178 @@
+package devctmpl_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestRevertTemplate(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "revert", "version": "1.0.0", "name": "Revert"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:12"}`)
+	writeFile(t, filepath.Join(src, "new/dir/file.txt"), "new\n")
+
+	existing := map[string]string{
+		".devcontainer/devcontainer.json": `{"image": "custom"}`,
+		"keep.txt":                        "keep\n",
+	}
+
+	tests := []struct {
+		name   string
+		policy devctmpl.ConflictPolicy
+		edit   map[string]string
+		force  bool
+		// wantChanged lists the files reported as changed after apply
+		wantChanged []string
+	}{
+		{name: "overwrite", policy: devctmpl.ConflictOverwrite},
+		{name: "backup", policy: devctmpl.ConflictBackup},
+		{
+			name:        "refuses edited files",
+			policy:      devctmpl.ConflictOverwrite,
+			edit:        map[string]string{"new/dir/file.txt": "edited\n"},
+			wantChanged: []string{"new/dir/file.txt"},
+		},
+		{
+			name:   "force",
+			policy: devctmpl.ConflictOverwrite,
+			edit:   map[string]string{"new/dir/file.txt": "edited\n"},
+			force:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			for name, content := range existing {
+				writeFile(t, filepath.Join(workspace, name), content)
+			}
+			before := listFiles(t, workspace)
+
+			config := devctmpl.NewConfig()
+			config.OnConflict = tt.policy
+			if err := devctmpl.GenerateTemplateWithConfig(src, workspace, nil, config); err != nil {
+				t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+			}
+			for name, content := range tt.edit {
+				writeFile(t, filepath.Join(workspace, name), content)
+			}
+
+			plan, err := devctmpl.RevertTemplate(workspace, tt.force)
+			if len(tt.wantChanged) > 0 {
+				if !errors.Is(err, devctmpl.ErrWorkspaceChanged) {
+					t.Fatalf("RevertTemplate() error = %v, want ErrWorkspaceChanged", err)
+				}
+				var changed []string
+				for _, file := range plan.Files {
+					if file.Action == devctmpl.ActionConflict {
+						changed = append(changed, file.Path)
+						if !strings.Contains(file.Diff, "+edited") {
+							t.Errorf("diff of %s = %q", file.Path, file.Diff)
+						}
+					}
+				}
+				if strings.Join(changed, ",") != strings.Join(tt.wantChanged, ",") {
+					t.Errorf("changed files = %v, want %v", changed, tt.wantChanged)
+				}
+				if _, err := os.Stat(filepath.Join(workspace, devctmpl.StateDir)); err != nil {
+					t.Errorf("refused revert removed the state: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RevertTemplate() error = %v", err)
+			}
+
+			if got := listFiles(t, workspace); strings.Join(got, ",") != strings.Join(before, ",") {
+				t.Errorf("files after revert = %v, want %v", got, before)
+			}
+			for name, want := range existing {
+				got, err := os.ReadFile(filepath.Join(workspace, name))
+				if err != nil || string(got) != want {
+					t.Errorf("%s = %q (%v), want %q", name, got, err, want)
+				}
+			}
+			for _, dir := range []string{"new", devctmpl.StateDir} {
+				if _, err := os.Stat(filepath.Join(workspace, dir)); !os.IsNotExist(err) {
+					t.Errorf("%s was not removed", dir)
+				}
+			}
+		})
+	}
+}
+
+func TestRevertTemplateRollback(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "revert", "version": "1.0.0", "name": "Revert"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:12"}`)
+	writeFile(t, filepath.Join(src, "new/dir/file.txt"), "new\n")
+
+	// setup returns a workspace the template was applied to
+	setup := func(t *testing.T) string {
+		workspace := t.TempDir()
+		writeFile(t, filepath.Join(workspace, ".devcontainer/devcontainer.json"), `{"image": "custom"}`)
+		config := devctmpl.NewConfig()
+		config.OnConflict = devctmpl.ConflictOverwrite
+		if err := devctmpl.GenerateTemplateWithConfig(src, workspace, nil, config); err != nil {
+			t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+		}
+		return workspace
+	}
+
+	// Count the renames of a successful revert
+	workspace := setup(t)
+	renames := 0
+	devctmpl.SetRename(t, func(oldpath, newpath string) error {
+		renames++
+		return os.Rename(oldpath, newpath)
+	})
+	if _, err := devctmpl.RevertTemplate(workspace, false); err != nil {
+		t.Fatalf("RevertTemplate() error = %v", err)
+	}
+	if renames == 0 {
+		t.Fatalf("revert did not rename any files")
+	}
+
+	// Fail each of them in turn
+	for fail := 1; fail <= renames; fail++ {
+		devctmpl.SetRename(t, os.Rename)
+		workspace := setup(t)
+		before := snapshot(t, workspace)
+
+		n := 0
+		devctmpl.SetRename(t, func(oldpath, newpath string) error {
+			if n++; n == fail {
+				return errInjected
+			}
+			return os.Rename(oldpath, newpath)
+		})
+		if _, err := devctmpl.RevertTemplate(workspace, false); !errors.Is(err, errInjected) {
+			t.Fatalf("revert with rename %d failing: error = %v, want injected failure", fail, err)
+		}
+		if after := snapshot(t, workspace); !reflect.DeepEqual(after, before) {
+			t.Errorf("rename %d failing: workspace not restored\ngot  %v\nwant %v", fail, after, before)
+		}
+	}
+
+	t.Run("cancelled context", func(t *testing.T) {
+		devctmpl.SetRename(t, os.Rename)
+		workspace := setup(t)
+		before := snapshot(t, workspace)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := devctmpl.RevertTemplateWithContext(ctx, workspace, false, devctmpl.NewConfig()); !errors.Is(err, context.Canceled) {
+			t.Fatalf("RevertTemplateWithContext() error = %v, want context.Canceled", err)
+		}
+		if after := snapshot(t, workspace); !reflect.DeepEqual(after, before) {
+			t.Errorf("workspace not restored\ngot  %v\nwant %v", after, before)
+		}
+	})
+}
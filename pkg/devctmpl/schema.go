@@ -0,0 +1,127 @@
+package devctmpl
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// jsonSchemaDialect is the JSON Schema draft used for generated schemas
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema needed to describe template options
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Examples             []any              `json:"examples,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+}
+
+// OptionsSchema returns a JSON Schema for the options of a template, suitable
+// for validating a --template-args document. Proposals become examples.
+func OptionsSchema(template *DevContainerTemplate) *Schema {
+	additional := false
+	schema := &Schema{
+		Schema:               jsonSchemaDialect,
+		Title:                template.Name,
+		Description:          template.Description,
+		Type:                 "object",
+		Properties:           make(map[string]*Schema, len(template.Options)),
+		AdditionalProperties: &additional,
+	}
+
+	for name, opt := range template.Options {
+		prop := &Schema{
+			Type:        "string",
+			Description: opt.Description,
+		}
+		if opt.Type == "boolean" {
+			prop.Type = "boolean"
+		}
+		for _, v := range opt.Enum {
+			prop.Enum = append(prop.Enum, prop.typedValue(v))
+		}
+		for _, v := range opt.Proposals {
+			prop.Examples = append(prop.Examples, prop.typedValue(v))
+		}
+		// Defaults computed from other options can't be expressed
+		if opt.Default != "" && !optionVarRegex.MatchString(opt.Default) {
+			prop.Default = prop.typedValue(opt.Default)
+		}
+		schema.Properties[name] = prop
+	}
+	return schema
+}
+
+// typedValue converts a string from the template metadata to the type of s
+func (s *Schema) typedValue(v string) any {
+	if s.Type == "boolean" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// Validate checks option values against the schema and reports every
+// violation found
+func (s *Schema) Validate(values map[string]any) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		value := values[name]
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties == nil || *s.AdditionalProperties {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("option '%s' is not defined in template (available options: %v)",
+				name,
+				s.propertyNames(),
+			))
+			continue
+		}
+		if err := prop.validateValue(value); err != nil {
+			errs = append(errs, fmt.Errorf("option '%s' %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Schema) validateValue(value any) error {
+	switch s.Type {
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be a boolean, got %q", fmt.Sprint(value))
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("must be a string, got %v", value)
+		}
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+		return fmt.Errorf("must be one of %v, got %q", s.Enum, fmt.Sprint(value))
+	}
+	return nil
+}
+
+func (s *Schema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,44 @@
+package devctmpl_test
+
+import (
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestOptionsSchema(t *testing.T) {
+	template, err := devctmpl.LoadTemplate("testdata/valid_template", devctmpl.NewConfig())
+	if err != nil {
+		t.Fatalf("LoadTemplate() error = %v", err)
+	}
+	schema := devctmpl.OptionsSchema(template)
+
+	if schema.Type != "object" || schema.AdditionalProperties == nil || *schema.AdditionalProperties {
+		t.Errorf("expected a closed object schema, got %+v", schema)
+	}
+	maven := schema.Properties["installMaven"]
+	if maven == nil || maven.Type != "boolean" || maven.Default != false {
+		t.Errorf("unexpected installMaven schema %+v", maven)
+	}
+	variant := schema.Properties["imageVariant"]
+	if variant == nil || variant.Type != "string" || len(variant.Examples) != 8 {
+		t.Errorf("unexpected imageVariant schema %+v", variant)
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]any
+		wantErr bool
+	}{
+		{name: "valid", values: map[string]any{"installMaven": true, "imageVariant": "17-bookworm"}},
+		{name: "wrong type", values: map[string]any{"installMaven": "yes"}, wantErr: true},
+		{name: "unknown option", values: map[string]any{"nope": "x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := schema.Validate(tt.values); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
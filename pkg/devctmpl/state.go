@@ -0,0 +1,238 @@
+package devctmpl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// StateDir is the directory in the workspace holding the state of the
+// applied template
+const StateDir = ".devctmpl"
+
+const stateFileName = "state.json"
+
+// configsDirName is the directory in a state directory holding the states
+// of templates applied as named sub-configurations
+const configsDirName = "configs"
+
+// State records how a template was applied to a workspace, so it can be
+// rendered again when the template is upgraded
+type State struct {
+	Source     string `json:"source"`
+	Digest     string `json:"digest"`
+	TemplateID string `json:"templateId"`
+	Version    string `json:"version"`
+	// Options are the options as given, without defaults
+	Options    map[string]string `json:"options,omitempty"`
+	OmitPaths  []string          `json:"omitPaths,omitempty"`
+	ConfigName string            `json:"configName,omitempty"`
+	Layout     Layout            `json:"layout,omitempty"`
+	AsConfig   string            `json:"asConfig,omitempty"`
+	// TargetSubdir is the path of the template inside the workspace
+	TargetSubdir string    `json:"targetSubdir,omitempty"`
+	Features     []Feature `json:"features,omitempty"`
+	Lock         bool      `json:"lock,omitempty"`
+	// Files maps the slash separated path of each rendered file to the
+	// hash of its content
+	Files map[string]string `json:"files"`
+	// Applied records the workspace files written, and Dirs the directories
+	// created, so the template can be reverted
+	Applied map[string]AppliedFile `json:"applied,omitempty"`
+	Dirs    []string               `json:"dirs,omitempty"`
+}
+
+// ReadState reads the state of the template applied to workspace
+func ReadState(workspace string) (*State, error) {
+	return ReadTargetState(workspace, "", "")
+}
+
+// ReadTargetState reads the state of the template applied to subdir of
+// workspace, as the sub-configuration asConfig if set
+func ReadTargetState(workspace string, subdir string, asConfig string) (*State, error) {
+	dir, err := stateDir(subdir, asConfig)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(dir), stateFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		target := workspace
+		if subdir != "" {
+			target = filepath.Join(workspace, filepath.FromSlash(subdir))
+		}
+		if asConfig != "" {
+			return nil, fmt.Errorf("no template has been applied to '%s' as configuration '%s'", target, asConfig)
+		}
+		return nil, fmt.Errorf("no template has been applied to '%s'", target)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template state: %w", err)
+	}
+	return parseState(data)
+}
+
+func parseState(data []byte) (*State, error) {
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse template state: %w", err)
+	}
+	return &state, nil
+}
+
+// stateDir returns the slash separated path of the state directory, relative
+// to the workspace, of a template applied to subdir as the sub-configuration
+// asConfig. Templates applied to different subdirectories or as different
+// configurations keep separate states, so each can be upgraded and reverted
+// on its own.
+func stateDir(subdir string, asConfig string) (string, error) {
+	dir := StateDir
+	if subdir != "" {
+		clean, err := cleanSubdir(subdir)
+		if err != nil {
+			return "", err
+		}
+		dir = path.Join(clean, StateDir)
+	}
+	if asConfig != "" {
+		if err := checkConfigName(asConfig); err != nil {
+			return "", err
+		}
+		dir = path.Join(dir, configsDirName, asConfig)
+	}
+	return dir, nil
+}
+
+// newState records the rendered template and the configuration it was
+// rendered with
+func newState(rendered *renderedTemplate, cfg Config) (*State, error) {
+	source := rendered.source
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		// Local sources are recorded by absolute path so upgrades work from
+		// any directory
+		if source, err = filepath.Abs(source); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := hashFiles(rendered.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash rendered files: %w", err)
+	}
+
+	return &State{
+		Source:       source,
+		Digest:       rendered.digest,
+		TemplateID:   rendered.template.ID,
+		Version:      rendered.template.Version,
+		Options:      rendered.options,
+		OmitPaths:    cfg.OmitPaths,
+		ConfigName:   cfg.ConfigName,
+		Layout:       cfg.Layout,
+		AsConfig:     cfg.AsConfig,
+		TargetSubdir: cfg.TargetSubdir,
+		Features:     cfg.Features,
+		Lock:         cfg.Lock,
+		Files:        files,
+	}, nil
+}
+
+// renderConfig returns cfg with the render settings recorded in the state
+func (s *State) renderConfig(cfg Config) Config {
+	cfg.OmitPaths = s.OmitPaths
+	cfg.ConfigName = s.ConfigName
+	cfg.Layout = s.Layout
+	cfg.AsConfig = s.AsConfig
+	cfg.TargetSubdir = s.TargetSubdir
+	cfg.Features = s.Features
+	cfg.Lock = s.Lock
+	return cfg
+}
+
+// pinnedSource returns the recorded source, pinned to the recorded digest
+// for OCI references
+func (s *State) pinnedSource() (string, error) {
+	if isOCIRepository(s.Source) {
+		return pinOCIReference(s.Source, s.Digest)
+	}
+	return s.Source, nil
+}
+
+// hashBytes returns the hash of data as recorded in the state
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// hashFiles hashes the regular files in dir by slash separated path
+func hashFiles(dir string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(rel)] = hashBytes(data)
+		return nil
+	})
+	return hashes, err
+}
+
+// treeDigest hashes the files of a template source directory, ignoring
+// version control metadata
+func treeDigest(dir string) (string, error) {
+	var paths []string
+	hashes := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if d.Type()&fs.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			data = []byte(link)
+		} else if data, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		paths = append(paths, rel)
+		hashes[rel] = hashBytes(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s\x00%s\n", path, hashes[path])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,142 @@
+package devctmpl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// localWorkspaceFolder is the devcontainer.json variable of the workspace
+// folder on the host
+const localWorkspaceFolder = "${localWorkspaceFolder}"
+
+// cleanSubdir validates a target subdirectory and returns it as a clean
+// slash separated path. It must be relative and stay inside the workspace.
+func cleanSubdir(subdir string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(subdir))
+	if path.IsAbs(clean) || filepath.IsAbs(subdir) || filepath.VolumeName(subdir) != "" {
+		return "", fmt.Errorf("target subdirectory '%s' must be a relative path", subdir)
+	}
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("target subdirectory '%s' must be inside the workspace", subdir)
+	}
+	return clean, nil
+}
+
+// checkSubdirInside checks that subdir of target doesn't leave target
+// through a symbolic link
+func checkSubdirInside(target string, subdir string) error {
+	root, err := filepath.EvalSymlinks(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Resolve the part of subdir that already exists
+	existing := target
+	for _, segment := range strings.Split(subdir, "/") {
+		next := filepath.Join(existing, segment)
+		if _, err := os.Lstat(next); err != nil {
+			break
+		}
+		existing = next
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("target subdirectory '%s' leaves the workspace through a symbolic link", subdir)
+	}
+	return nil
+}
+
+// moveToSubdir moves the rendered template into subdir of a new temporary
+// directory and adjusts its configurations to the workspace being the
+// parent of subdir
+func (r *renderedTemplate) moveToSubdir(subdir string, tmpRootDir string) error {
+	if err := adjustConfigsForSubdir(r.dir, subdir); err != nil {
+		return err
+	}
+
+	root, err := getTmpDir(tmpRootDir, "devcontainer-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	dst := filepath.Join(root, filepath.FromSlash(subdir))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		os.RemoveAll(root)
+		return err
+	}
+	if err := os.Rename(r.dir, dst); err != nil {
+		os.RemoveAll(root)
+		return fmt.Errorf("failed to move rendered template to '%s': %w", subdir, err)
+	}
+	r.dir = root
+
+	for i, omitted := range r.omitted {
+		r.omitted[i] = path.Join(subdir, omitted)
+	}
+	return nil
+}
+
+// adjustConfigsForSubdir adjusts the devcontainer.json files in dir, which
+// are written to subdir of the workspace. The workspace folder in the
+// container is moved to subdir, unless Docker Compose sets up the mounts,
+// and paths starting with ${localWorkspaceFolder} are moved to subdir.
+// Relative paths resolve against the configuration and stay unchanged.
+func adjustConfigsForSubdir(dir string, subdir string) error {
+	configs, err := findDevContainerJson(dir)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		file := filepath.Join(dir, filepath.FromSlash(config.Path))
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		doc, err := jsonc.Parse(content)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", config.Path, err)
+		}
+
+		err = replaceConfigPaths(doc, func(value string) (string, bool) {
+			if rest, ok := strings.CutPrefix(value, localWorkspaceFolder); ok && (rest == "" || rest[0] == '/') {
+				return localWorkspaceFolder + "/" + subdir + rest, true
+			}
+			return "", false
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := doc.Get("/dockerComposeFile"); err != nil {
+			workspaceFolder := "/workspaces/${localWorkspaceFolderBasename}"
+			if node, err := doc.Get("/workspaceFolder"); err == nil && node.Kind == jsonc.String {
+				workspaceFolder = node.String()
+			}
+			if err := doc.Set("/workspaceFolder", path.Join(workspaceFolder, subdir)); err != nil {
+				return err
+			}
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, doc.Bytes(), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package devctmpl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestGenerateTemplateTargetSubdir(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		subdir  string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "default workspace folder",
+			files: map[string]string{
+				".devcontainer/devcontainer.json": `{"build": {"dockerfile": "Dockerfile", "context": ".."}}`,
+				".devcontainer/Dockerfile":        "FROM debian",
+			},
+			subdir: "services/api",
+			want: map[string]string{
+				"services/api/.devcontainer/devcontainer.json": `{"build": {"dockerfile": "Dockerfile", "context": ".."}, "workspaceFolder": "/workspaces/${localWorkspaceFolderBasename}/services/api"}`,
+				"services/api/.devcontainer/Dockerfile":        "FROM debian",
+			},
+		},
+		{
+			name: "workspace variables",
+			files: map[string]string{
+				".devcontainer.json": `{"image": "debian", "workspaceFolder": "/workspace", "build": {"context": "${localWorkspaceFolder}"}, "dockerFile": "${localWorkspaceFolder}/Dockerfile"}`,
+			},
+			subdir: "./services/api/",
+			want: map[string]string{
+				"services/api/.devcontainer.json": `{"image": "debian", "workspaceFolder": "/workspace/services/api", "build": {"context": "${localWorkspaceFolder}/services/api"}, "dockerFile": "${localWorkspaceFolder}/services/api/Dockerfile"}`,
+			},
+		},
+		{
+			name: "docker compose",
+			files: map[string]string{
+				".devcontainer/devcontainer.json": `{"dockerComposeFile": "compose.yml", "service": "app", "workspaceFolder": "/workspaces/app"}`,
+			},
+			subdir: "app",
+			want: map[string]string{
+				"app/.devcontainer/devcontainer.json": `{"dockerComposeFile": "compose.yml", "service": "app", "workspaceFolder": "/workspaces/app"}`,
+			},
+		},
+		{
+			name:    "parent directory",
+			files:   map[string]string{".devcontainer.json": `{}`},
+			subdir:  "services/../../api",
+			wantErr: "must be inside the workspace",
+		},
+		{
+			name:    "absolute path",
+			files:   map[string]string{".devcontainer.json": `{}`},
+			subdir:  "/services/api",
+			wantErr: "must be a relative path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "subdir", "version": "1.0.0", "name": "Subdir"}`)
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(src, name), content)
+			}
+
+			target := t.TempDir()
+			config := devctmpl.NewConfig()
+			config.TargetSubdir = tt.subdir
+			err := devctmpl.GenerateTemplateWithConfig(src, target, nil, config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GenerateTemplateWithConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+			}
+
+			for name, want := range tt.want {
+				got, err := os.ReadFile(filepath.Join(target, name))
+				if err != nil {
+					t.Errorf("expected %s in output: %v", name, err)
+					continue
+				}
+				if strings.TrimSpace(string(got)) != want {
+					t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+				}
+			}
+			state, err := devctmpl.ReadTargetState(target, tt.subdir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.TargetSubdir != tt.subdir {
+				t.Errorf("state TargetSubdir = %q, want %q", state.TargetSubdir, tt.subdir)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateTargetSubdirSymlink(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "subdir", "version": "1.0.0", "name": "Subdir"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer.json"), `{"image": "debian"}`)
+
+	target := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(target, "services")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	config := devctmpl.NewConfig()
+	config.TargetSubdir = "services/api"
+	err := devctmpl.GenerateTemplateWithConfig(src, target, nil, config)
+	if err == nil || !strings.Contains(err.Error(), "leaves the workspace") {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v, want symlink error", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("files written outside the workspace: %v", entries)
+	}
+}
+
+func TestTemplateStatePerTarget(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "targets", "version": "1.0.0", "name": "Targets",
+		"options": {"tag": {"type": "string", "description": "Tag", "default": "12"}}
+	}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:${templateOption:tag}"}`)
+
+	targets := []devctmpl.Config{
+		{TargetSubdir: "services/api"},
+		{TargetSubdir: "services/web"},
+		{AsConfig: "extra"},
+		{TargetSubdir: "services/api", AsConfig: "extra"},
+	}
+	workspace := t.TempDir()
+	for _, target := range targets {
+		config := devctmpl.NewConfig()
+		config.TargetSubdir = target.TargetSubdir
+		config.AsConfig = target.AsConfig
+		if err := devctmpl.GenerateTemplateWithConfig(src, workspace, nil, config); err != nil {
+			t.Fatalf("GenerateTemplateWithConfig(%q, %q) error = %v", target.TargetSubdir, target.AsConfig, err)
+		}
+	}
+	for _, target := range targets {
+		state, err := devctmpl.ReadTargetState(workspace, target.TargetSubdir, target.AsConfig)
+		if err != nil {
+			t.Fatalf("ReadTargetState(%q, %q) error = %v", target.TargetSubdir, target.AsConfig, err)
+		}
+		if state.TargetSubdir != target.TargetSubdir || state.AsConfig != target.AsConfig || len(state.Files) != 1 {
+			t.Errorf("state of %q, %q = %+v", target.TargetSubdir, target.AsConfig, state)
+		}
+	}
+	if _, err := devctmpl.ReadState(workspace); err == nil {
+		t.Errorf("ReadState() found a state for the workspace root")
+	}
+
+	// Upgrading one target leaves the others alone
+	config := devctmpl.NewConfig()
+	config.TargetSubdir = "services/api"
+	if _, err := devctmpl.UpgradeTemplate(workspace, devctmpl.UpgradeOptions{Options: map[string]string{"tag": "13"}}, config); err != nil {
+		t.Fatalf("UpgradeTemplate() error = %v", err)
+	}
+	for name, want := range map[string]string{
+		"services/api/.devcontainer/devcontainer.json":       `"image": "debian:13"`,
+		"services/web/.devcontainer/devcontainer.json":       `"image": "debian:12"`,
+		"services/api/.devcontainer/extra/devcontainer.json": `"image": "debian:12"`,
+		".devcontainer/extra/devcontainer.json":              `"image": "debian:12"`,
+	} {
+		got, err := os.ReadFile(filepath.Join(workspace, name))
+		if err != nil || !strings.Contains(string(got), want) {
+			t.Errorf("%s = %q (%v), want %s", name, got, err, want)
+		}
+	}
+
+	// Reverting one target keeps the others and their states
+	config = devctmpl.NewConfig()
+	config.TargetSubdir = "services/api"
+	if _, err := devctmpl.RevertTemplateWithConfig(workspace, false, config); err != nil {
+		t.Fatalf("RevertTemplateWithConfig() error = %v", err)
+	}
+	want := []string{
+		".devcontainer/extra/devcontainer.json",
+		"services/api/.devcontainer/extra/devcontainer.json",
+		"services/web/.devcontainer/devcontainer.json",
+	}
+	if got := listFiles(t, workspace); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files after revert = %v, want %v", got, want)
+	}
+	if _, err := devctmpl.ReadTargetState(workspace, "services/api", "extra"); err != nil {
+		t.Errorf("revert removed the state of another target: %v", err)
+	}
+
+	for _, target := range []devctmpl.Config{{TargetSubdir: "services/api", AsConfig: "extra"}, {TargetSubdir: "services/web"}, {AsConfig: "extra"}} {
+		if _, err := devctmpl.RevertTemplateWithConfig(workspace, false, target); err != nil {
+			t.Fatalf("RevertTemplateWithConfig(%q, %q) error = %v", target.TargetSubdir, target.AsConfig, err)
+		}
+	}
+	// Directories created for a target that was reverted while other
+	// targets still used them stay
+	if got := listFiles(t, workspace); len(got) != 0 {
+		t.Errorf("files after reverting all targets = %v, want none", got)
+	}
+	for _, dir := range []string{".", "services/api", "services/web"} {
+		if _, err := os.Stat(filepath.Join(workspace, dir, devctmpl.StateDir)); !os.IsNotExist(err) {
+			t.Errorf("state directory in %s was not removed", dir)
+		}
+	}
+}
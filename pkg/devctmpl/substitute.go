@@ -0,0 +1,173 @@
+package devctmpl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// binarySniffLen is the number of leading bytes inspected to detect binary
+// files, the same heuristic git uses
+const binarySniffLen = 8000
+
+// optionVarRegex matches template variables of the form ${templateOption:key}
+// with an optional escaping filter, e.g. ${templateOption:key|shellquote}
+var optionVarRegex = regexp.MustCompile(`\${templateOption:([^}|]+)(?:\|([^}]*))?}`)
+
+// ReplaceTemplateOptions walks through all files in the directory and replaces
+// template variables of the form ${templateOption:key} with their corresponding values.
+// Values are escaped according to the file type and position, see escape.go.
+// Binary files and files matching one of the exclude patterns are left untouched.
+func replaceTemplateOptions(dir string, options map[string]string, exclude *pathMatcher) error {
+	return fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories, symlinks, excluded files and files rendered with text/template
+		if !d.Type().IsRegular() || exclude.match(path, false) || strings.HasSuffix(path, goTemplateSuffix) {
+			return nil
+		}
+
+		if err := substituteFile(filepath.Join(dir, path), options); err != nil {
+			return fmt.Errorf("failed to replace options in file %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// substituteFile streams a file line by line into a temporary sibling and
+// replaces the original only if something changed, keeping its mode
+func substituteFile(name string, options map[string]string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(f, binarySniffLen)
+	head, err := r.Peek(binarySniffLen)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if isBinary(head) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".devctmpl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	scanner := newContextScanner(name)
+	changed := false
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			newLine, err := replaceOptionVars(line, options, scanner)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if !bytes.Equal(line, newLine) {
+				changed = true
+			}
+			if _, err := w.Write(newLine); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// replaceOptionVars replaces all template variables in a line. If scanner is
+// not nil it's advanced over the line and used to escape the values.
+func replaceOptionVars(line []byte, options map[string]string, scanner contextScanner) ([]byte, error) {
+	matches := optionVarRegex.FindAllSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		if scanner != nil {
+			scanner.scan(line)
+		}
+		return line, nil
+	}
+
+	var out []byte
+	last := 0
+	for _, m := range matches {
+		if scanner != nil {
+			scanner.scan(line[last:m[0]])
+		}
+		out = append(out, line[last:m[0]]...)
+		last = m[1]
+
+		key := string(line[m[2]:m[3]])
+		filter := ""
+		if m[4] >= 0 {
+			filter = string(line[m[4]:m[5]])
+		}
+
+		escape, hasFilter := optionFilters[filter]
+		if filter != "" && !hasFilter {
+			return nil, fmt.Errorf("unknown filter '%s' for option '%s'", filter, key)
+		}
+
+		value, exists := options[key]
+		switch {
+		case !exists:
+			// If no value found, leave original template variable
+			out = append(out, line[m[0]:m[1]]...)
+		case hasFilter:
+			out = append(out, escape(value)...)
+		case scanner != nil:
+			out = append(out, escapeValue(scanner.context(), value, line[m[1]:])...)
+		default:
+			out = append(out, value...)
+		}
+
+		// Keep the scanner in sync with the original text
+		if scanner != nil {
+			scanner.scan(line[m[0]:m[1]])
+		}
+	}
+	if scanner != nil {
+		scanner.scan(line[last:])
+	}
+	return append(out, line[last:]...), nil
+}
+
+// isBinary reports whether data looks like the start of a binary file
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) != -1
+}
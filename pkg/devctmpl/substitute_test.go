@@ -0,0 +1,64 @@
+package devctmpl_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestGenerateTemplateSubstitution(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{
+		"id": "subst", "version": "1.0.0", "name": "Substitution",
+		"options": {"user": {"type": "string", "description": "User", "default": "vscode"}},
+		"substitutionExclude": [".devcontainer/verbatim"]
+	}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "devcontainer.json"), `{"remoteUser": "${templateOption:user}"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer", "postCreate.sh"), "#!/bin/sh\necho ${templateOption:user}\n")
+	if err := os.Chmod(filepath.Join(src, ".devcontainer", "postCreate.sh"), 0755); err != nil {
+		t.Fatalf("failed to chmod: %v", err)
+	}
+	binary := []byte("\x00\x01${templateOption:user}\x02")
+	writeFile(t, filepath.Join(src, ".devcontainer", "logo.png"), string(binary))
+	writeFile(t, filepath.Join(src, ".devcontainer", "verbatim", "notes.txt"), "${templateOption:user}")
+
+	target := t.TempDir()
+	if err := devctmpl.GenerateTemplate(src, target, map[string]string{"user": "dev"}); err != nil {
+		t.Fatalf("GenerateTemplate() error = %v", err)
+	}
+
+	script := filepath.Join(target, ".devcontainer", "postCreate.sh")
+	content, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatalf("failed to read script: %v", err)
+	}
+	if string(content) != "#!/bin/sh\necho dev\n" {
+		t.Errorf("unexpected script content %q", content)
+	}
+	info, err := os.Stat(script)
+	if err != nil {
+		t.Fatalf("failed to stat script: %v", err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("executable bit lost, mode = %v", info.Mode())
+	}
+
+	content, err = os.ReadFile(filepath.Join(target, ".devcontainer", "logo.png"))
+	if err != nil {
+		t.Fatalf("failed to read binary: %v", err)
+	}
+	if !bytes.Equal(content, binary) {
+		t.Errorf("binary file was modified: %q", content)
+	}
+
+	content, err = os.ReadFile(filepath.Join(target, ".devcontainer", "verbatim", "notes.txt"))
+	if err != nil {
+		t.Fatalf("failed to read excluded file: %v", err)
+	}
+	if string(content) != "${templateOption:user}" {
+		t.Errorf("excluded file was modified: %q", content)
+	}
+}
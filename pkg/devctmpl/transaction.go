@@ -0,0 +1,275 @@
+package devctmpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/otiai10/copy"
+)
+
+// stagePattern names the staging directory created in the workspace while a
+// template is applied
+const stagePattern = ".devctmpl-stage-*"
+
+// File system operations used by transactions, replaced in tests to inject
+// failures
+var (
+	osRename    = os.Rename
+	osWriteFile = os.WriteFile
+)
+
+// transaction changes files in a workspace so that all changes can be rolled
+// back. New content is written to a staging directory in the workspace first
+// and renamed into place; replaced and removed files are moved to the
+// staging directory, so a rollback can move them back.
+type transaction struct {
+	ctx   context.Context
+	root  string
+	stage string
+	// undo holds the operations reverting each change, in order
+	undo      []func() error
+	undoErrs  []error
+	n         int
+	committed bool
+}
+
+// beginTransaction starts a transaction on the workspace root, creating it
+// if needed
+func beginTransaction(ctx context.Context, root string) (*transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tx := &transaction{ctx: ctx, root: root}
+	if _, err := tx.mkdirAbs(root); err != nil {
+		return nil, fmt.Errorf("failed to create target directory: %w", err)
+	}
+	stage, err := os.MkdirTemp(root, stagePattern)
+	if err != nil {
+		tx.rollback()
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	tx.stage = stage
+	tx.undo = append(tx.undo, func() error {
+		// Files that could not be moved back are kept in the staging
+		// directory
+		if len(tx.undoErrs) > 0 {
+			return nil
+		}
+		return os.RemoveAll(stage)
+	})
+	return tx, nil
+}
+
+// commit keeps the changes and removes the staging directory
+func (tx *transaction) commit() {
+	tx.committed = true
+	os.RemoveAll(tx.stage)
+}
+
+// rollback reverts all changes unless the transaction was committed
+func (tx *transaction) rollback() error {
+	if tx.committed {
+		return nil
+	}
+	tx.committed = true
+
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i](); err != nil {
+			tx.undoErrs = append(tx.undoErrs, err)
+		}
+	}
+	if len(tx.undoErrs) > 0 {
+		return fmt.Errorf("failed to roll back changes, moved files are kept in '%s': %w", tx.stage, errors.Join(tx.undoErrs...))
+	}
+	return nil
+}
+
+// check returns an error if the transaction's context is done
+func (tx *transaction) check() error {
+	return tx.ctx.Err()
+}
+
+func (tx *transaction) path(rel string) string {
+	return filepath.Join(tx.root, filepath.FromSlash(rel))
+}
+
+// stagePath returns a new unique path in the staging directory
+func (tx *transaction) stagePath() string {
+	tx.n++
+	return filepath.Join(tx.stage, fmt.Sprintf("%d", tx.n))
+}
+
+// mkdirAll creates the directory rel and its parents. It returns the
+// directories that were created.
+func (tx *transaction) mkdirAll(rel string) ([]string, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	created, err := tx.mkdirAbs(tx.path(rel))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	for i, dir := range created {
+		rel, err := filepath.Rel(tx.root, dir)
+		if err != nil {
+			return nil, err
+		}
+		created[i] = filepath.ToSlash(rel)
+	}
+	return created, nil
+}
+
+func (tx *transaction) mkdirAbs(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	var created []string
+	for i := len(missing) - 1; i >= 0; i-- {
+		d := missing[i]
+		if err := os.Mkdir(d, 0755); err != nil {
+			return nil, err
+		}
+		tx.undo = append(tx.undo, func() error { return os.Remove(d) })
+		created = append(created, d)
+	}
+	return created, nil
+}
+
+// moveAside moves an existing file rel to the staging directory, so it can
+// be restored on rollback
+func (tx *transaction) moveAside(rel string) error {
+	dst := tx.path(rel)
+	if _, err := os.Lstat(dst); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	aside := tx.stagePath()
+	if err := osRename(dst, aside); err != nil {
+		return fmt.Errorf("failed to move '%s': %w", rel, err)
+	}
+	tx.undo = append(tx.undo, func() error { return os.Rename(aside, dst) })
+	return nil
+}
+
+// place moves the staged file into place at rel, replacing an existing file
+func (tx *transaction) place(staged string, rel string) error {
+	if err := tx.moveAside(rel); err != nil {
+		return err
+	}
+	if _, err := tx.mkdirAll(path.Dir(rel)); err != nil {
+		return err
+	}
+	dst := tx.path(rel)
+	if err := osRename(staged, dst); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", rel, err)
+	}
+	tx.undo = append(tx.undo, func() error { return os.Remove(dst) })
+	return nil
+}
+
+// writeFile writes data to rel
+func (tx *transaction) writeFile(rel string, data []byte, mode fs.FileMode) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	staged := tx.stagePath()
+	if err := osWriteFile(staged, data, mode); err != nil {
+		return fmt.Errorf("failed to stage '%s': %w", rel, err)
+	}
+	return tx.place(staged, rel)
+}
+
+// copyFile copies the file src to rel, keeping its mode
+func (tx *transaction) copyFile(src string, rel string) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	staged := tx.stagePath()
+	if err := copy.Copy(src, staged); err != nil {
+		return fmt.Errorf("failed to stage '%s': %w", rel, err)
+	}
+	return tx.place(staged, rel)
+}
+
+// remove removes the file rel
+func (tx *transaction) remove(rel string) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	return tx.moveAside(rel)
+}
+
+// rename renames the file from to to, which must not exist
+func (tx *transaction) rename(from string, to string) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	src, dst := tx.path(from), tx.path(to)
+	if err := osRename(src, dst); err != nil {
+		return fmt.Errorf("failed to rename '%s': %w", from, err)
+	}
+	tx.undo = append(tx.undo, func() error { return os.Rename(dst, src) })
+	return nil
+}
+
+// removeEmptyDir removes the directory rel if it is empty. It reports
+// whether the directory was removed.
+func (tx *transaction) removeEmptyDir(rel string) (bool, error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	full := tx.path(rel)
+	entries, err := os.ReadDir(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(entries) > 0 {
+		return false, nil
+	}
+	if err := os.Remove(full); err != nil {
+		return false, fmt.Errorf("failed to remove directory '%s': %w", rel, err)
+	}
+	tx.undo = append(tx.undo, func() error { return os.Mkdir(full, 0755) })
+	return true, nil
+}
+
+// removeEmptyParents removes the parent directories of rel that are empty
+func (tx *transaction) removeEmptyParents(rel string) error {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		full := tx.path(dir)
+		entries, err := os.ReadDir(full)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return nil
+		}
+		if err := os.Remove(full); err != nil {
+			return fmt.Errorf("failed to remove directory '%s': %w", dir, err)
+		}
+		tx.undo = append(tx.undo, func() error { return os.Mkdir(full, 0755) })
+	}
+	return nil
+}
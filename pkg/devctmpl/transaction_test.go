@@ -0,0 +1,141 @@
+package devctmpl_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+var errInjected = errors.New("injected failure")
+
+// snapshot returns the content of every file and directory in dir
+func snapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			files[rel+"/"] = ""
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to snapshot %s: %v", dir, err)
+	}
+	return files
+}
+
+func TestGenerateTemplateRollback(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "rollback", "version": "1.0.0", "name": "Rollback"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:12"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/Dockerfile"), "FROM debian:12\n")
+	writeFile(t, filepath.Join(src, "scripts/deep/setup.sh"), "#!/bin/sh\n")
+
+	setup := func(t *testing.T) string {
+		workspace := filepath.Join(t.TempDir(), "workspace")
+		writeFile(t, filepath.Join(workspace, ".devcontainer/devcontainer.json"), `{"image": "custom"}`)
+		writeFile(t, filepath.Join(workspace, "README.md"), "readme\n")
+		return workspace
+	}
+	apply := func(workspace string, policy devctmpl.ConflictPolicy) error {
+		config := devctmpl.NewConfig()
+		config.OnConflict = policy
+		return devctmpl.GenerateTemplateWithConfig(src, workspace, nil, config)
+	}
+
+	for _, policy := range []devctmpl.ConflictPolicy{devctmpl.ConflictOverwrite, devctmpl.ConflictBackup} {
+		// Count the renames of a successful apply
+		renames := 0
+		devctmpl.SetRename(t, func(oldpath, newpath string) error {
+			renames++
+			return os.Rename(oldpath, newpath)
+		})
+		if err := apply(setup(t), policy); err != nil {
+			t.Fatalf("%s: apply error = %v", policy, err)
+		}
+		if renames == 0 {
+			t.Fatalf("%s: apply did not rename any files", policy)
+		}
+
+		// Fail each of them in turn
+		for fail := 1; fail <= renames; fail++ {
+			workspace := setup(t)
+			before := snapshot(t, workspace)
+
+			n := 0
+			devctmpl.SetRename(t, func(oldpath, newpath string) error {
+				if n++; n == fail {
+					return errInjected
+				}
+				return os.Rename(oldpath, newpath)
+			})
+			if err := apply(workspace, policy); !errors.Is(err, errInjected) {
+				t.Fatalf("%s: apply with rename %d failing: error = %v, want injected failure", policy, fail, err)
+			}
+			if after := snapshot(t, workspace); !reflect.DeepEqual(after, before) {
+				t.Errorf("%s: rename %d failing: workspace not restored\ngot  %v\nwant %v", policy, fail, after, before)
+			}
+		}
+	}
+
+	t.Run("staging failure in new workspace", func(t *testing.T) {
+		workspace := filepath.Join(t.TempDir(), "new", "workspace")
+		writes := 0
+		devctmpl.SetWriteFile(t, func(name string, data []byte, perm fs.FileMode) error {
+			if writes++; writes == 3 {
+				return errInjected
+			}
+			return os.WriteFile(name, data, perm)
+		})
+		if err := apply(workspace, devctmpl.ConflictFail); !errors.Is(err, errInjected) {
+			t.Fatalf("apply error = %v, want injected failure", err)
+		}
+		if _, err := os.Stat(filepath.Dir(workspace)); !os.IsNotExist(err) {
+			t.Errorf("created workspace directories were not removed")
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		workspace := setup(t)
+		writeFile(t, filepath.Join(workspace, ".devcontainer/Dockerfile"), "FROM custom\n")
+		before := snapshot(t, workspace)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config := devctmpl.NewConfig()
+		config.OnConflict = devctmpl.ConflictPrompt
+		config.Prompt = func(file devctmpl.PlannedFile) (devctmpl.ConflictPolicy, error) {
+			// Cancel after the first conflicting file was overwritten
+			if file.Path == ".devcontainer/devcontainer.json" {
+				cancel()
+			}
+			return devctmpl.ConflictOverwrite, nil
+		}
+		err := devctmpl.GenerateTemplateWithContext(ctx, src, workspace, nil, config)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("GenerateTemplateWithContext() error = %v, want context.Canceled", err)
+		}
+		if after := snapshot(t, workspace); !reflect.DeepEqual(after, before) {
+			t.Errorf("workspace not restored\ngot  %v\nwant %v", after, before)
+		}
+	})
+}
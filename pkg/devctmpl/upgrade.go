@@ -0,0 +1,294 @@
+package devctmpl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// UpgradeOptions configure UpgradeTemplate
+type UpgradeOptions struct {
+	// Source is the new template version, the recorded source if empty.
+	// Sources such as OCI tags that moved upgrade to their current version.
+	Source string
+	// Options override the recorded options
+	Options map[string]string
+	// Base is the previously applied template version. It is only needed if
+	// the recorded source does not reproduce it anymore.
+	Base string
+	// DryRun computes the plan without changing the workspace
+	DryRun bool
+}
+
+// UpgradeTemplate upgrades the template applied to workspace to a new
+// version. The previously applied and the new version are rendered with the
+// recorded options, and the changes between them are merged into the
+// workspace, keeping local edits. Text files that were changed on both sides
+// get conflict markers, devcontainer.json files are merged member by member.
+// cfg.TargetSubdir and cfg.AsConfig select the template to upgrade if several
+// were applied to the workspace.
+func UpgradeTemplate(workspace string, opts UpgradeOptions, cfg Config) (*Plan, error) {
+	return UpgradeTemplateWithContext(context.Background(), workspace, opts, cfg)
+}
+
+// UpgradeTemplateWithContext is UpgradeTemplate with a context. If ctx is
+// cancelled while the workspace is changed, the changes made so far are
+// rolled back.
+func UpgradeTemplateWithContext(ctx context.Context, workspace string, opts UpgradeOptions, cfg Config) (*Plan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	state, err := ReadTargetState(workspace, cfg.TargetSubdir, cfg.AsConfig)
+	if err != nil {
+		return nil, err
+	}
+	renderCfg := state.renderConfig(cfg)
+
+	baseSource := opts.Base
+	if baseSource == "" {
+		if baseSource, err = state.pinnedSource(); err != nil {
+			return nil, err
+		}
+	}
+	base, err := renderTemplate(baseSource, state.Options, renderCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render applied template version: %w", err)
+	}
+	defer base.cleanup()
+	if opts.Base == "" && base.digest != state.Digest {
+		return nil, fmt.Errorf("template source '%s' changed since it was applied (digest %s, applied %s), provide the applied version as base", state.Source, base.digest, state.Digest)
+	}
+
+	source := opts.Source
+	if source == "" {
+		source = state.Source
+	}
+	options := maps.Clone(state.Options)
+	if options == nil {
+		options = make(map[string]string)
+	}
+	maps.Copy(options, opts.Options)
+	next, err := renderTemplate(source, options, renderCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render new template version: %w", err)
+	}
+	defer next.cleanup()
+
+	plan, contents, err := planUpgrade(base.dir, next.dir, workspace)
+	if err != nil {
+		return nil, err
+	}
+	plan.Template = next.template.ID
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	if err := applyUpgrade(ctx, plan, contents, next, workspace, renderCfg); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planUpgrade merges the changes between the rendered baseDir and nextDir
+// into workspace. It returns the plan and the new content of each file to
+// write.
+func planUpgrade(baseDir string, nextDir string, workspace string) (*Plan, map[string][]byte, error) {
+	baseFiles, err := hashFiles(baseDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	nextFiles, err := hashFiles(nextDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := slices.Sorted(maps.Keys(baseFiles))
+	for p := range nextFiles {
+		if _, ok := baseFiles[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+
+	plan := &Plan{Target: workspace, Files: []PlannedFile{}}
+	contents := make(map[string][]byte)
+	for _, rel := range paths {
+		baseData, inBase, err := readOptionalFile(filepath.Join(baseDir, rel))
+		if err != nil {
+			return nil, nil, err
+		}
+		nextData, inNext, err := readOptionalFile(filepath.Join(nextDir, rel))
+		if err != nil {
+			return nil, nil, err
+		}
+		ourData, inOurs, err := readOptionalFile(filepath.Join(workspace, rel))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		file := PlannedFile{Path: rel, Action: ActionUnchanged}
+		switch {
+		case inBase && inNext && bytes.Equal(baseData, nextData):
+			// Not changed by the template
+		case !inOurs && !inBase:
+			file.Action = ActionCreate
+			contents[rel] = nextData
+		case !inOurs:
+			if inNext {
+				file.Action = ActionConflict
+				file.Reason = "deleted in workspace, changed in template"
+			}
+		case inNext && bytes.Equal(ourData, nextData):
+			// Already up to date
+		case !inNext:
+			if bytes.Equal(ourData, baseData) {
+				file.Action = ActionDelete
+			} else {
+				file.Action = ActionConflict
+				file.Reason = "changed in workspace, removed from template"
+			}
+		case inBase && bytes.Equal(ourData, baseData):
+			file.Action = ActionModify
+			contents[rel] = nextData
+		default:
+			merged, reason := mergeFile(rel, baseData, ourData, nextData)
+			if merged == nil {
+				file.Action = ActionConflict
+				file.Reason = reason
+				break
+			}
+			file.Action = ActionMerge
+			if reason != "" {
+				file.Action = ActionConflict
+				file.Reason = reason
+			}
+			contents[rel] = merged
+		}
+		if data, ok := contents[rel]; ok && inOurs {
+			file.Diff = unifiedDiff("a/"+rel, "b/"+rel, ourData, data)
+		}
+		plan.Files = append(plan.Files, file)
+	}
+	return plan, contents, nil
+}
+
+// mergeFile merges a file changed both in the workspace and the template.
+// It returns the merged content, nil if the file can't be merged, and the
+// reason why the merge conflicts.
+func mergeFile(rel string, base []byte, ours []byte, theirs []byte) ([]byte, string) {
+	if isBinary(base) || isBinary(ours) || isBinary(theirs) {
+		return nil, "binary file changed in workspace and template"
+	}
+
+	if name := path.Base(rel); name == "devcontainer.json" || name == ".devcontainer.json" {
+		merged, conflicts, err := mergeJSONC(base, ours, theirs)
+		if err == nil {
+			if len(conflicts) > 0 {
+				return merged, "conflicting changes at " + strings.Join(conflicts, ", ") + ", workspace values kept"
+			}
+			return merged, ""
+		}
+		// Fall back to a text merge if either version doesn't parse
+	}
+
+	merged, conflicts := mergeText(base, ours, theirs)
+	if conflicts > 0 {
+		return merged, fmt.Sprintf("%d conflicts marked in file", conflicts)
+	}
+	return merged, ""
+}
+
+// applyUpgrade writes the planned changes to workspace in a transaction
+// and records the new state
+func applyUpgrade(ctx context.Context, plan *Plan, contents map[string][]byte, next *renderedTemplate, workspace string, cfg Config) (err error) {
+	dir, err := stateDir(cfg.TargetSubdir, cfg.AsConfig)
+	if err != nil {
+		return err
+	}
+	tx, err := beginTransaction(ctx, workspace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.rollback(); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+		}
+	}()
+
+	j, err := openJournal(tx, dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range plan.Files {
+		if file.Action == ActionDelete {
+			if err := j.record(file.Path); err != nil {
+				return err
+			}
+			if err := tx.remove(file.Path); err != nil {
+				return err
+			}
+			if err := j.written(file.Path, nil); err != nil {
+				return err
+			}
+			if err := tx.removeEmptyParents(file.Path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, ok := contents[file.Path]
+		if !ok {
+			continue
+		}
+		// Keep the mode of workspace files, new files get the template's
+		mode := fs.FileMode(0644)
+		if info, err := os.Stat(tx.path(file.Path)); err == nil {
+			mode = info.Mode().Perm()
+		} else if info, err := os.Stat(filepath.Join(next.dir, filepath.FromSlash(file.Path))); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := j.record(file.Path); err != nil {
+			return err
+		}
+		if err := j.mkdirAll(path.Dir(file.Path)); err != nil {
+			return err
+		}
+		if err := tx.writeFile(file.Path, data, mode); err != nil {
+			return err
+		}
+		if err := j.written(file.Path, data); err != nil {
+			return err
+		}
+	}
+
+	state, err := newState(next, cfg)
+	if err != nil {
+		return err
+	}
+	if err := j.writeState(state); err != nil {
+		return err
+	}
+	tx.commit()
+	return nil
+}
+
+// readOptionalFile reads a file, reporting whether it exists
+func readOptionalFile(name string) ([]byte, bool, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
@@ -0,0 +1,182 @@
+package devctmpl_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestUpgradeTemplate(t *testing.T) {
+	metadata := `{"id": "upgrade", "version": "%s", "name": "Upgrade", "options": {"tag": {"type": "string", "default": "12"}}}`
+
+	v1 := t.TempDir()
+	writeFile(t, filepath.Join(v1, "devcontainer-template.json"), strings.Replace(metadata, "%s", "1.0.0", 1))
+	writeFile(t, filepath.Join(v1, ".devcontainer/devcontainer.json"), `{
+	// Base image
+	"image": "debian:${templateOption:tag}",
+	"features": {
+		"ghcr.io/devcontainers/features/git:1": {}
+	}
+}
+`)
+	writeFile(t, filepath.Join(v1, "script.sh"), "one\ntwo\nthree\nfour\nfive\n")
+	writeFile(t, filepath.Join(v1, "conflict.txt"), "a\nb\nc\n")
+	writeFile(t, filepath.Join(v1, "removed.txt"), "removed\n")
+	writeFile(t, filepath.Join(v1, "kept.txt"), "kept\n")
+
+	v2 := t.TempDir()
+	writeFile(t, filepath.Join(v2, "devcontainer-template.json"), strings.Replace(metadata, "%s", "2.0.0", 1))
+	writeFile(t, filepath.Join(v2, ".devcontainer/devcontainer.json"), `{
+	// Base image
+	"image": "debian:${templateOption:tag}",
+	"features": {
+		"ghcr.io/devcontainers/features/git:1": {},
+		"ghcr.io/devcontainers/features/node:1": {}
+	}
+}
+`)
+	writeFile(t, filepath.Join(v2, "script.sh"), "one\ntwo\nthree\nfour\nFIVE\n")
+	writeFile(t, filepath.Join(v2, "conflict.txt"), "a\nB from template\nc\n")
+	writeFile(t, filepath.Join(v2, "added.txt"), "added\n")
+	writeFile(t, filepath.Join(v2, "kept.txt"), "kept\n")
+
+	workspace := t.TempDir()
+	if err := devctmpl.GenerateTemplateWithConfig(v1, workspace, map[string]string{"tag": "11"}, devctmpl.NewConfig()); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+	state, err := devctmpl.ReadState(workspace)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if state.Version != "1.0.0" || state.Options["tag"] != "11" || state.Files["script.sh"] == "" || !strings.HasPrefix(state.Digest, "sha256:") {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	// Local edits
+	writeFile(t, filepath.Join(workspace, ".devcontainer/devcontainer.json"), `{
+	// Base image
+	"image": "debian:11",
+	"features": {
+		"ghcr.io/devcontainers/features/git:1": {}
+	},
+	"remoteUser": "dev"
+}
+`)
+	writeFile(t, filepath.Join(workspace, "script.sh"), "ONE\ntwo\nthree\nfour\nfive\n")
+	writeFile(t, filepath.Join(workspace, "conflict.txt"), "a\nB from workspace\nc\n")
+
+	plan, err := devctmpl.UpgradeTemplate(workspace, devctmpl.UpgradeOptions{Source: v2}, devctmpl.NewConfig())
+	if err != nil {
+		t.Fatalf("UpgradeTemplate() error = %v", err)
+	}
+
+	actions := make(map[string]devctmpl.FileAction)
+	for _, file := range plan.Files {
+		actions[file.Path] = file.Action
+	}
+	wantActions := map[string]devctmpl.FileAction{
+		".devcontainer/devcontainer.json": devctmpl.ActionMerge,
+		"added.txt":                       devctmpl.ActionCreate,
+		"conflict.txt":                    devctmpl.ActionConflict,
+		"kept.txt":                        devctmpl.ActionUnchanged,
+		"removed.txt":                     devctmpl.ActionDelete,
+		"script.sh":                       devctmpl.ActionMerge,
+	}
+	for path, want := range wantActions {
+		if actions[path] != want {
+			t.Errorf("action of %s = %q, want %q", path, actions[path], want)
+		}
+	}
+
+	wantFiles := map[string]string{
+		"script.sh":    "ONE\ntwo\nthree\nfour\nFIVE\n",
+		"conflict.txt": "a\n<<<<<<< workspace\nB from workspace\n=======\nB from template\n>>>>>>> template\nc\n",
+		"added.txt":    "added\n",
+		".devcontainer/devcontainer.json": `{
+	// Base image
+	"image": "debian:11",
+	"features": {
+		"ghcr.io/devcontainers/features/git:1": {},
+		"ghcr.io/devcontainers/features/node:1": {}
+	},
+	"remoteUser": "dev"
+}
+`,
+	}
+	for name, want := range wantFiles {
+		got, err := os.ReadFile(filepath.Join(workspace, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "removed.txt")); !os.IsNotExist(err) {
+		t.Errorf("removed.txt was not deleted")
+	}
+
+	state, err = devctmpl.ReadState(workspace)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if state.Version != "2.0.0" || state.Source != v2 {
+		t.Errorf("state not updated: %+v", state)
+	}
+}
+
+func TestUpgradeTemplateChangedSource(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "changed", "version": "1.0.0", "name": "Changed"}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:11"}`)
+
+	workspace := t.TempDir()
+	if err := devctmpl.GenerateTemplateWithConfig(src, workspace, nil, devctmpl.NewConfig()); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+
+	// The applied version can't be reproduced from a local source that changed
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:12"}`)
+	_, err := devctmpl.UpgradeTemplate(workspace, devctmpl.UpgradeOptions{}, devctmpl.NewConfig())
+	if err == nil || !strings.Contains(err.Error(), "changed since it was applied") {
+		t.Fatalf("UpgradeTemplate() error = %v, want changed source error", err)
+	}
+
+	if _, err := devctmpl.UpgradeTemplate(t.TempDir(), devctmpl.UpgradeOptions{}, devctmpl.NewConfig()); err == nil {
+		t.Fatalf("UpgradeTemplate() without state succeeded")
+	}
+}
+
+func TestUpgradeTemplateCancelled(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "devcontainer-template.json"), `{"id": "upgrade", "version": "1.0.0", "name": "Upgrade", "options": {"tag": {"type": "string", "default": "12"}}}`)
+	writeFile(t, filepath.Join(src, ".devcontainer/devcontainer.json"), `{"image": "debian:${templateOption:tag}"}`)
+	writeFile(t, filepath.Join(src, "script.sh"), "${templateOption:tag}\n")
+
+	workspace := t.TempDir()
+	if err := devctmpl.GenerateTemplateWithConfig(src, workspace, nil, devctmpl.NewConfig()); err != nil {
+		t.Fatalf("GenerateTemplateWithConfig() error = %v", err)
+	}
+	before := snapshot(t, workspace)
+
+	// Cancel once the first file was moved into place
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	devctmpl.SetRename(t, func(oldpath, newpath string) error {
+		cancel()
+		return os.Rename(oldpath, newpath)
+	})
+	opts := devctmpl.UpgradeOptions{Options: map[string]string{"tag": "13"}}
+	if _, err := devctmpl.UpgradeTemplateWithContext(ctx, workspace, opts, devctmpl.NewConfig()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("UpgradeTemplateWithContext() error = %v, want context.Canceled", err)
+	}
+	if after := snapshot(t, workspace); !reflect.DeepEqual(after, before) {
+		t.Errorf("workspace not restored\ngot  %v\nwant %v", after, before)
+	}
+}
@@ -0,0 +1,384 @@
+package devctmpl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+// semverRegex is the regular expression recommended by semver.org
+var semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// optionIdentifierRegex matches valid option keys
+var optionIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// TemplateRules are the checks run by ValidateTemplate
+var TemplateRules = []Rule{
+	{ID: "metadata", Description: "devcontainer-template.json exists and is valid JSON"},
+	{ID: "devcontainer-config", Description: "The template contains a devcontainer.json"},
+	{ID: "required-field", Description: "The id, version and name fields are set"},
+	{ID: "semver", Description: "The version is a valid semantic version"},
+	{ID: "id-matches-folder", Description: "The id matches the name of the template folder"},
+	{ID: "option-identifier", Description: "Option keys are valid identifiers"},
+	{ID: "undefined-option", Description: "Every option used in template files is defined"},
+	{ID: "unused-option", Description: "Every defined option is used"},
+	{ID: "unknown-filter", Description: "Option filters are supported"},
+	{ID: "template-syntax", Description: "Go template files parse"},
+	{ID: "optional-path", Description: "Every optional path matches a template file"},
+	{ID: "default-in-enum", Description: "Option defaults are members of the option enum"},
+}
+
+// optionUse is a location where a template option is referenced
+type optionUse struct {
+	file string
+	line int
+}
+
+// ValidateTemplate checks the template in dir against the template spec and
+// returns every issue found. File paths in issues are joined with dir.
+func ValidateTemplate(dir string) ([]Issue, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	v := &templateValidator{dir: dir, metadataFile: filepath.Join(dir, "devcontainer-template.json")}
+	v.validate()
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		if v.issues[i].File != v.issues[j].File {
+			return v.issues[i].File < v.issues[j].File
+		}
+		return v.issues[i].Line < v.issues[j].Line
+	})
+	return v.issues, nil
+}
+
+type templateValidator struct {
+	dir          string
+	metadataFile string
+	metadata     *jsonc.Document
+	issues       []Issue
+}
+
+func (v *templateValidator) report(rule string, severity Severity, file string, line int, format string, args ...any) {
+	v.issues = append(v.issues, Issue{
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		File:     file,
+		Line:     line,
+	})
+}
+
+// metadataLine returns the line of the value the JSON pointer refers to in
+// devcontainer-template.json, or 0 if it can't be located
+func (v *templateValidator) metadataLine(pointer string) int {
+	if v.metadata == nil {
+		return 0
+	}
+	node, err := v.metadata.Get(pointer)
+	if err != nil {
+		return 0
+	}
+	line, _ := v.metadata.Position(node)
+	return line
+}
+
+func (v *templateValidator) validate() {
+	content, err := os.ReadFile(v.metadataFile)
+	if err != nil {
+		v.report("metadata", SeverityError, v.metadataFile, 0, "failed to read devcontainer-template.json: %v", err)
+		return
+	}
+	var template DevContainerTemplate
+	if err := json.Unmarshal(content, &template); err != nil {
+		line := 0
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line = 1 + bytes.Count(content[:syntaxErr.Offset], []byte("\n"))
+		}
+		v.report("metadata", SeverityError, v.metadataFile, line, "invalid devcontainer-template.json: %v", err)
+		return
+	}
+	// Valid JSON is valid JSONC, the parsed tree locates values by pointer
+	if doc, err := jsonc.Parse(content); err == nil {
+		v.metadata = doc
+	}
+
+	if _, err := findDevContainerJson(v.dir); err != nil {
+		v.report("devcontainer-config", SeverityError, "", 0, "%v", err)
+	}
+
+	v.checkFields(&template)
+	v.checkOptions(&template)
+	v.checkOptionalPaths(&template)
+}
+
+func (v *templateValidator) checkFields(template *DevContainerTemplate) {
+	required := []struct{ field, value string }{
+		{"id", template.ID},
+		{"version", template.Version},
+		{"name", template.Name},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			v.report("required-field", SeverityError, v.metadataFile, 0, "required field '%s' is missing", r.field)
+		}
+	}
+
+	if template.Version != "" && !semverRegex.MatchString(template.Version) {
+		v.report("semver", SeverityError, v.metadataFile, v.metadataLine("/version"),
+			"version '%s' is not a valid semantic version", template.Version)
+	}
+
+	abs, err := filepath.Abs(v.dir)
+	if err == nil && template.ID != "" && template.ID != filepath.Base(abs) {
+		v.report("id-matches-folder", SeverityError, v.metadataFile, v.metadataLine("/id"),
+			"id '%s' does not match the template folder name '%s'", template.ID, filepath.Base(abs))
+	}
+}
+
+func (v *templateValidator) checkOptions(template *DevContainerTemplate) {
+	uses, err := v.collectOptionUses(template)
+	if err != nil {
+		v.report("undefined-option", SeverityError, "", 0, "failed to scan template files: %v", err)
+		return
+	}
+
+	names := make([]string, 0, len(template.Options))
+	for name := range template.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		opt := template.Options[name]
+		line := v.metadataLine("/options/" + jsonc.EscapePointer(name))
+
+		if !optionIdentifierRegex.MatchString(name) {
+			v.report("option-identifier", SeverityError, v.metadataFile, line,
+				"option key '%s' is not a valid identifier", name)
+		}
+
+		if opt.Default != "" && len(opt.Enum) > 0 && !slices.Contains(opt.Enum, opt.Default) {
+			v.report("default-in-enum", SeverityError, v.metadataFile, line,
+				"default '%s' of option '%s' is not one of %v", opt.Default, name, opt.Enum)
+		}
+
+		// Defaults referencing other options count as uses
+		for _, ref := range optionVarRegex.FindAllStringSubmatch(opt.Default, -1) {
+			uses[ref[1]] = append(uses[ref[1]], optionUse{file: v.metadataFile, line: line})
+		}
+	}
+
+	for _, name := range names {
+		if len(uses[name]) == 0 {
+			v.report("unused-option", SeverityWarning, v.metadataFile, v.metadataLine("/options/"+jsonc.EscapePointer(name)),
+				"option '%s' is defined but not used", name)
+		}
+	}
+
+	for name, locations := range uses {
+		if _, defined := template.Options[name]; defined {
+			continue
+		}
+		for _, loc := range locations {
+			v.report("undefined-option", SeverityError, loc.file, loc.line,
+				"option '%s' is used but not defined", name)
+		}
+	}
+}
+
+func (v *templateValidator) checkOptionalPaths(template *DevContainerTemplate) {
+	for i, pattern := range template.OptionalPaths {
+		line := v.metadataLine(fmt.Sprintf("/optionalPaths/%d", i))
+		compiled, err := compilePathPattern(pattern)
+		if err != nil {
+			v.report("optional-path", SeverityError, v.metadataFile, line, "%v", err)
+			continue
+		}
+		// A negated pattern has to match something to have an effect as well
+		compiled.negate = false
+		m := &pathMatcher{patterns: []pathPattern{compiled}}
+
+		matched := false
+		err = fs.WalkDir(os.DirFS(v.dir), ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != "." && m.match(path, d.IsDir()) {
+				matched = true
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil || !matched {
+			v.report("optional-path", SeverityError, v.metadataFile, line,
+				"optional path '%s' does not match any file", pattern)
+		}
+	}
+}
+
+// collectOptionUses finds every template option referenced by the files
+// that are applied to a workspace. Files excluded from substitution are
+// copied verbatim, so the references in them are not uses.
+func (v *templateValidator) collectOptionUses(template *DevContainerTemplate) (map[string][]optionUse, error) {
+	exclude, err := compilePathPatterns(template.SubstitutionExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid substitutionExclude: %w", err)
+	}
+	uses := make(map[string][]optionUse)
+	err = fs.WalkDir(os.DirFS(v.dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || slices.Contains(templateMetadataFiles, path) || exclude.match(path, false) {
+			return nil
+		}
+
+		file := filepath.Join(v.dir, filepath.FromSlash(path))
+		if strings.HasSuffix(path, goTemplateSuffix) {
+			return v.collectGoTemplateUses(file, path, uses)
+		}
+		return v.collectVarUses(file, uses)
+	})
+	return uses, err
+}
+
+func (v *templateValidator) collectVarUses(file string, uses map[string][]optionUse) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, binarySniffLen)
+	head, err := r.Peek(binarySniffLen)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if isBinary(head) {
+		return nil
+	}
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		for _, m := range optionVarRegex.FindAllSubmatch(line, -1) {
+			name := string(m[1])
+			uses[name] = append(uses[name], optionUse{file: file, line: lineNo})
+			if filter := string(m[2]); filter != "" {
+				if _, ok := optionFilters[filter]; !ok {
+					v.report("unknown-filter", SeverityError, file, lineNo,
+						"unknown filter '%s' for option '%s'", filter, name)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (v *templateValidator) collectGoTemplateUses(file string, name string, uses map[string][]optionUse) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	t, err := template.New(name).Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		v.report("template-syntax", SeverityError, file, 0, "%v", err)
+		return nil
+	}
+
+	visit := func(option string, pos parse.Pos) {
+		line := 1 + bytes.Count(content[:pos], []byte("\n"))
+		uses[option] = append(uses[option], optionUse{file: file, line: line})
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			walkTemplateFields(tmpl.Tree.Root, true, visit)
+		}
+	}
+	return nil
+}
+
+// walkTemplateFields calls visit for every option referenced in a parse tree.
+// Fields are only options where dot is the root data, not inside range or with.
+func walkTemplateFields(node parse.Node, dotIsRoot bool, visit func(string, parse.Pos)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateFields(child, dotIsRoot, visit)
+		}
+	case *parse.ActionNode:
+		walkTemplateFields(n.Pipe, dotIsRoot, visit)
+	case *parse.IfNode:
+		walkTemplateFields(n.Pipe, dotIsRoot, visit)
+		walkTemplateFields(n.List, dotIsRoot, visit)
+		walkTemplateFields(n.ElseList, dotIsRoot, visit)
+	case *parse.RangeNode:
+		walkTemplateFields(n.Pipe, dotIsRoot, visit)
+		walkTemplateFields(n.List, false, visit)
+		walkTemplateFields(n.ElseList, dotIsRoot, visit)
+	case *parse.WithNode:
+		walkTemplateFields(n.Pipe, dotIsRoot, visit)
+		walkTemplateFields(n.List, false, visit)
+		walkTemplateFields(n.ElseList, dotIsRoot, visit)
+	case *parse.TemplateNode:
+		walkTemplateFields(n.Pipe, dotIsRoot, visit)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplateFields(cmd, dotIsRoot, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplateFields(arg, dotIsRoot, visit)
+		}
+	case *parse.ChainNode:
+		walkTemplateFields(n.Node, dotIsRoot, visit)
+	case *parse.FieldNode:
+		if dotIsRoot {
+			visit(n.Ident[0], n.Pos)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			visit(n.Ident[1], n.Pos)
+		}
+	}
+}
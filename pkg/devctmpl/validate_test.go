@@ -0,0 +1,189 @@
+package devctmpl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/devctmpl"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  string
+		files     map[string]string
+		wantRules []string
+	}{
+		{
+			name:     "valid",
+			metadata: `{"id": "java", "version": "1.2.3", "name": "Java", "options": {"variant": {"type": "string", "description": "Variant"}}}`,
+			files: map[string]string{
+				".devcontainer/devcontainer.json": `{"image": "java:${templateOption:variant}"}`,
+			},
+		},
+		{
+			name:     "missing fields",
+			metadata: `{"id": "java"}`,
+			files: map[string]string{
+				".devcontainer/devcontainer.json": `{}`,
+			},
+			wantRules: []string{"required-field", "required-field"},
+		},
+		{
+			name: "spec violations",
+			metadata: `{
+				"id": "other", "version": "1.2", "name": "Java",
+				"options": {
+					"bad-key": {"type": "string", "description": "Bad", "default": "x"},
+					"variant": {"type": "string", "description": "Variant", "enum": ["a", "b"], "default": "c"}
+				},
+				"optionalPaths": ["missing/*"]
+			}`,
+			files: map[string]string{
+				".devcontainer/devcontainer.json": `{"image": "java:${templateOption:variant}-${templateOption:undefined}"}`,
+			},
+			wantRules: []string{"default-in-enum", "id-matches-folder", "option-identifier", "optional-path", "semver", "undefined-option", "unused-option"},
+		},
+		{
+			name:     "go template uses",
+			metadata: `{"id": "java", "version": "1.0.0", "name": "Java", "options": {"maven": {"type": "boolean", "description": "Maven"}}}`,
+			files: map[string]string{
+				".devcontainer/devcontainer.json.tmpl": `{ {{- if .maven }}"a": 1{{ end }}{{ .gradle }} }`,
+			},
+			wantRules: []string{"undefined-option"},
+		},
+		{
+			name: "substitution excluded files",
+			metadata: `{
+				"id": "java", "version": "1.0.0", "name": "Java",
+				"options": {
+					"variant": {"type": "string", "description": "Variant"},
+					"docs": {"type": "string", "description": "Docs"}
+				},
+				"substitutionExclude": [".devcontainer/docs"]
+			}`,
+			files: map[string]string{
+				".devcontainer/devcontainer.json":      `{"image": "java:${templateOption:variant}"}`,
+				".devcontainer/docs/README.md":         "Set ${templateOption:docs} and ${templateOption:undefined}",
+				".devcontainer/docs/example.json.tmpl": `{{ .undefined }}`,
+			},
+			wantRules: []string{"unused-option"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "java")
+			writeFile(t, filepath.Join(dir, "devcontainer-template.json"), tt.metadata)
+			for name, content := range tt.files {
+				writeFile(t, filepath.Join(dir, name), content)
+			}
+
+			issues, err := devctmpl.ValidateTemplate(dir)
+			if err != nil {
+				t.Fatalf("ValidateTemplate() error = %v", err)
+			}
+			var rules []string
+			for _, issue := range issues {
+				rules = append(rules, issue.Rule)
+			}
+			sort.Strings(rules)
+			if len(rules) != len(tt.wantRules) {
+				t.Fatalf("got issues %v, want rules %v", issues, tt.wantRules)
+			}
+			for i := range rules {
+				if rules[i] != tt.wantRules[i] {
+					t.Fatalf("got issues %v, want rules %v", issues, tt.wantRules)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTemplateLines(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "java")
+	metadata := filepath.Join(dir, "devcontainer-template.json")
+	writeFile(t, metadata, `{
+	"id": "java", "version": "1.0.0", "name": "Java",
+	"options": {
+		"name": {"type": "string", "description": "Name", "enum": ["a"], "default": "b"},
+		"java": {"type": "string", "description": "Java"}
+	},
+	"optionalPaths": [
+		"docs/*",
+		"missing/*"
+	]
+}`)
+	writeFile(t, filepath.Join(dir, ".devcontainer", "devcontainer.json"), `{"name": "${templateOption:name}"}`)
+	writeFile(t, filepath.Join(dir, "docs", "README.md"), "")
+
+	issues, err := devctmpl.ValidateTemplate(dir)
+	if err != nil {
+		t.Fatalf("ValidateTemplate() error = %v", err)
+	}
+	lines := make(map[string]int)
+	for _, issue := range issues {
+		if issue.File != metadata {
+			t.Errorf("unexpected issue %v", issue)
+		}
+		lines[issue.Rule] = issue.Line
+	}
+	want := map[string]int{"default-in-enum": 4, "unused-option": 5, "optional-path": 9}
+	if len(lines) != len(want) {
+		t.Fatalf("got issues %v, want rules on lines %v", issues, want)
+	}
+	for rule, line := range want {
+		if lines[rule] != line {
+			t.Errorf("%s reported on line %d, want %d", rule, lines[rule], line)
+		}
+	}
+}
+
+func TestWriteReportSARIF(t *testing.T) {
+	issues := []devctmpl.Issue{{
+		Rule:     "semver",
+		Severity: devctmpl.SeverityError,
+		Message:  "version '1.2' is not a valid semantic version",
+		File:     "src/java/devcontainer-template.json",
+		Line:     3,
+	}}
+
+	var buf bytes.Buffer
+	if err := devctmpl.WriteReport(&buf, devctmpl.FormatSARIF, devctmpl.TemplateRules, issues); err != nil {
+		t.Fatalf("WriteReport() error = %v", err)
+	}
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid SARIF JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 1 {
+		t.Fatalf("unexpected SARIF log: %s", buf.String())
+	}
+	result := log.Runs[0].Results[0]
+	loc := result.Locations[0].PhysicalLocation
+	if result.RuleID != "semver" || result.Level != "error" || loc.ArtifactLocation.URI != "src/java/devcontainer-template.json" || loc.Region.StartLine != 3 {
+		t.Errorf("unexpected SARIF result: %s", buf.String())
+	}
+}
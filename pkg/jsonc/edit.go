@@ -0,0 +1,322 @@
+package jsonc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// edit replaces the bytes from start to end with text
+type edit struct {
+	start, end int
+	text       string
+}
+
+// apply applies non-overlapping edits and parses the result again
+func (d *Document) apply(edits ...edit) error {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	data := bytes.Clone(d.data)
+	for _, e := range edits {
+		data = append(data[:e.start], append([]byte(e.text), data[e.end:]...)...)
+	}
+	root, err := (&parser{data: data}).document()
+	if err != nil {
+		return fmt.Errorf("edit produced an invalid document: %w", err)
+	}
+	d.data, d.Root = data, root
+	return nil
+}
+
+// detectIndent returns the indentation of the first member or element on
+// its own line, or a tab
+func (d *Document) detectIndent() string {
+	var first int
+	switch {
+	case d.Root.Kind == Object && len(d.Root.Members) > 0:
+		first = d.Root.Members[0].start
+	case d.Root.Kind == Array && len(d.Root.Elements) > 0:
+		first = d.Root.Elements[0].start
+	default:
+		return "\t"
+	}
+	if indent, ok := d.ownLine(first); ok && indent != "" {
+		return indent
+	}
+	return "\t"
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func (d *Document) lineIndent(offset int) string {
+	start := bytes.LastIndexByte(d.data[:offset], '\n') + 1
+	end := start
+	for end < len(d.data) && (d.data[end] == ' ' || d.data[end] == '\t') {
+		end++
+	}
+	return string(d.data[start:end])
+}
+
+// ownLine reports whether only whitespace precedes offset on its line, and
+// returns that whitespace
+func (d *Document) ownLine(offset int) (string, bool) {
+	start := bytes.LastIndexByte(d.data[:offset], '\n') + 1
+	prefix := string(d.data[start:offset])
+	return prefix, strings.TrimLeft(prefix, " \t") == ""
+}
+
+// encode encodes value as JSON, indenting nested lines by prefix.
+// json.RawMessage values are inserted as they are.
+func (d *Document) encode(value any, prefix string) (string, error) {
+	if raw, ok := value.(json.RawMessage); ok {
+		if err := Validate(raw); err != nil {
+			return "", fmt.Errorf("invalid raw value: %w", err)
+		}
+		return string(raw), nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(prefix, d.indent)
+	if err := enc.Encode(value); err != nil {
+		return "", fmt.Errorf("failed to encode value: %w", err)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func (d *Document) member(key string, value any, prefix string) (string, error) {
+	k, err := d.encode(key, "")
+	if err != nil {
+		return "", err
+	}
+	v, err := d.encode(value, prefix)
+	if err != nil {
+		return "", err
+	}
+	return k + ": " + v, nil
+}
+
+// Set sets the value the JSON pointer refers to. Missing object members,
+// including parents, are created; "-" or the length of an array appends to
+// it. The rest of the document is kept as it is.
+func (d *Document) Set(pointer string, value any) error {
+	return d.set(pointer, value, "")
+}
+
+// SetBefore is like Set, but a new member is inserted before the sibling
+// member next instead of at the end of its object
+func (d *Document) SetBefore(pointer string, value any, next string) error {
+	return d.set(pointer, value, next)
+}
+
+func (d *Document) set(pointer string, value any, next string) error {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+
+	// Find the deepest existing value
+	n, prefix := d.Root, ""
+	i := 0
+	for ; i < len(tokens); i++ {
+		child := n.child(tokens[i])
+		if child == nil {
+			break
+		}
+		if start, ok := n.itemStart(tokens[i]); ok {
+			prefix = d.lineIndent(start)
+		}
+		n = child
+	}
+	if i == len(tokens) {
+		text, err := d.encode(value, prefix)
+		if err != nil {
+			return err
+		}
+		return d.apply(edit{n.start, n.start + len(n.raw), text})
+	}
+
+	// Wrap the value in the missing parents
+	for j := len(tokens) - 1; j > i; j-- {
+		value = map[string]any{tokens[j]: value}
+	}
+	switch n.Kind {
+	case Object:
+		return d.insertMember(n, tokens[i], value, next)
+	case Array:
+		if tokens[i] != "-" && tokens[i] != fmt.Sprint(len(n.Elements)) {
+			return fmt.Errorf("%w: %s", ErrNotFound, formatPointer(tokens[:i+1]))
+		}
+		return d.appendElement(n, value)
+	default:
+		return fmt.Errorf("cannot set %s: %s is a %s", pointer, formatPointer(tokens[:i]), n.Kind)
+	}
+}
+
+// itemStart returns the offset of the member or element named by token
+func (n *Node) itemStart(token string) (int, bool) {
+	switch n.Kind {
+	case Object:
+		if m := n.Member(token); m != nil {
+			return m.Value.start, true
+		}
+	case Array:
+		if i, ok := arrayIndex(token); ok && i < len(n.Elements) {
+			return n.Elements[i].Value.start, true
+		}
+	}
+	return 0, false
+}
+
+// items returns the positions of the members or elements of n
+func (n *Node) items() []*item {
+	var items []*item
+	for _, m := range n.Members {
+		items = append(items, &m.item)
+	}
+	for _, e := range n.Elements {
+		items = append(items, &e.item)
+	}
+	return items
+}
+
+func (d *Document) insertMember(obj *Node, key string, value any, next string) error {
+	items := obj.items()
+	if m := obj.Member(next); m != nil && next != "" {
+		indent, ownLine := d.ownLine(m.start)
+		text, err := d.member(key, value, d.lineIndent(m.start))
+		if err != nil {
+			return err
+		}
+		if ownLine {
+			return d.apply(edit{m.start, m.start, text + ",\n" + indent})
+		}
+		return d.apply(edit{m.start, m.start, text + ", "})
+	}
+	return d.insertItem(obj, items, func(prefix string) (string, error) {
+		return d.member(key, value, prefix)
+	})
+}
+
+func (d *Document) appendElement(arr *Node, value any) error {
+	return d.insertItem(arr, arr.items(), func(prefix string) (string, error) {
+		return d.encode(value, prefix)
+	})
+}
+
+// insertItem appends the text returned by format to the object or array n,
+// following the layout of its existing items
+func (d *Document) insertItem(n *Node, items []*item, format func(prefix string) (string, error)) error {
+	end := n.start + len(n.raw) - 1
+	if len(items) == 0 {
+		base := d.lineIndent(n.start)
+		indent := base + d.indent
+		text, err := format(indent)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(d.data[n.start+1:end])) == "" {
+			return d.apply(edit{n.start + 1, end, "\n" + indent + text + "\n" + base})
+		}
+		// Keep the comments in the empty value
+		return d.apply(edit{n.start + 1, n.start + 1, "\n" + indent + text})
+	}
+
+	first, last := items[0], items[len(items)-1]
+	indent, ownLine := d.ownLine(first.start)
+	if !ownLine {
+		indent = d.lineIndent(first.start)
+	}
+	text, err := format(indent)
+	if err != nil {
+		return err
+	}
+	if ownLine {
+		text = "\n" + indent + text
+		if last.comma >= 0 {
+			text += ","
+		}
+	} else {
+		text = " " + text
+	}
+	if last.comma < 0 {
+		if last.end == last.valueEnd {
+			return d.apply(edit{last.end, last.end, "," + text})
+		}
+		return d.apply(edit{last.valueEnd, last.valueEnd, ","}, edit{last.end, last.end, text})
+	}
+	return d.apply(edit{last.end, last.end, text})
+}
+
+// Delete removes the member or element the JSON pointer refers to, with
+// its comments
+func (d *Document) Delete(pointer string) error {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("cannot delete the root value")
+	}
+	parent, err := d.Get(formatPointer(tokens[:len(tokens)-1]))
+	if err != nil {
+		return err
+	}
+	items := parent.items()
+	index := -1
+	token := tokens[len(tokens)-1]
+	switch parent.Kind {
+	case Object:
+		for i := len(parent.Members) - 1; i >= 0 && index < 0; i-- {
+			if parent.Members[i].Key == token {
+				index = i
+			}
+		}
+	case Array:
+		if i, ok := arrayIndex(token); ok && i < len(parent.Elements) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, pointer)
+	}
+
+	it := items[index]
+	start, end := it.start, it.end
+	_, ownLine := d.ownLine(start)
+	lineEnd := end
+	for lineEnd < len(d.data) && (d.data[lineEnd] == ' ' || d.data[lineEnd] == '\t' || d.data[lineEnd] == '\r') {
+		lineEnd++
+	}
+	wholeLine := ownLine && (lineEnd == len(d.data) || d.data[lineEnd] == '\n')
+
+	if len(items) == 1 {
+		close := parent.start + len(parent.raw) - 1
+		if strings.TrimSpace(string(d.data[parent.start+1:start])+string(d.data[end:close])) == "" {
+			return d.apply(edit{parent.start + 1, close, ""})
+		}
+	}
+
+	var edits []edit
+	switch {
+	case wholeLine:
+		start = bytes.LastIndexByte(d.data[:start], '\n') + 1
+		end = min(lineEnd+1, len(d.data))
+		edits = append(edits, edit{start, end, ""})
+		if index == len(items)-1 && it.comma < 0 && index > 0 && items[index-1].comma >= 0 {
+			prev := items[index-1]
+			edits = append(edits, edit{prev.comma, prev.comma + 1, ""})
+		}
+	case index == len(items)-1 && it.comma < 0 && index > 0 && items[index-1].comma >= 0:
+		// Remove the comma of the previous item on the same line
+		prev := items[index-1]
+		if prev.end == prev.comma+1 {
+			edits = append(edits, edit{prev.comma, end, ""})
+		} else {
+			edits = append(edits, edit{prev.comma, prev.comma + 1, ""}, edit{start, end, ""})
+		}
+	default:
+		edits = append(edits, edit{start, lineEnd, ""})
+	}
+	return d.apply(edits...)
+}
@@ -0,0 +1,287 @@
+// Package jsonc parses JSON with comments and trailing commas (JSONC), as
+// used by devcontainer.json, into a tree that can be edited without losing
+// comments or formatting.
+//
+// A Document keeps the original text. Edits made with Set, SetBefore and
+// Delete only rewrite the affected members, so Bytes returns the original
+// text with minimal changes.
+package jsonc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a JSON value
+type Kind int
+
+const (
+	Null Kind = iota
+	Bool
+	Number
+	String
+	Object
+	Array
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Null:
+		return "null"
+	case Bool:
+		return "boolean"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Object:
+		return "object"
+	case Array:
+		return "array"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// ErrNotFound is returned when a JSON pointer does not refer to a value
+var ErrNotFound = errors.New("value not found")
+
+// SyntaxError is a syntax error in a JSONC document
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// Node is a value in a document
+type Node struct {
+	Kind Kind
+	// Members holds the members of an object in document order
+	Members []*Member
+	// Elements holds the elements of an array
+	Elements []*Element
+
+	raw   []byte
+	start int
+}
+
+// Member is an object member with the comments attached to it
+type Member struct {
+	Key   string
+	Value *Node
+	// Comments are the comments on the lines before the member
+	Comments []string
+	// LineComment is a comment following the member on the same line
+	LineComment string
+	item
+}
+
+// Element is an array element with the comments attached to it
+type Element struct {
+	Value *Node
+	// Comments are the comments on the lines before the element
+	Comments []string
+	// LineComment is a comment following the element on the same line
+	LineComment string
+	item
+}
+
+// item locates a member or element in the document
+type item struct {
+	// start is the offset of its first comment, or of the key or value
+	start int
+	// valueEnd is the end of the value, end the end of the following comma
+	// or line comment
+	valueEnd int
+	end      int
+	// comma is the offset of the following comma, or -1
+	comma int
+}
+
+// Raw returns the text of the value as it appears in the document
+func (n *Node) Raw() []byte {
+	return n.raw
+}
+
+// Decode decodes the value into v like json.Unmarshal
+func (n *Node) Decode(v any) error {
+	data, err := ToJSON(n.raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Value returns the value decoded into map[string]any, []any, string,
+// json.Number, bool or nil
+func (n *Node) Value() (any, error) {
+	data, err := ToJSON(n.raw)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	err = dec.Decode(&v)
+	return v, err
+}
+
+// Member returns the member with the given key, or nil. If the key is
+// duplicated the last member wins, as in encoding/json.
+func (n *Node) Member(key string) *Member {
+	for i := len(n.Members) - 1; i >= 0; i-- {
+		if n.Members[i].Key == key {
+			return n.Members[i]
+		}
+	}
+	return nil
+}
+
+// String returns the value of a string node, or an empty string for other
+// kinds
+func (n *Node) String() string {
+	if n.Kind != String {
+		return ""
+	}
+	var s string
+	json.Unmarshal(n.raw, &s)
+	return s
+}
+
+// Document is a parsed JSONC document
+type Document struct {
+	Root   *Node
+	data   []byte
+	indent string
+}
+
+// Parse parses a JSONC document. Duplicate keys are allowed, use Validate
+// to reject them.
+func Parse(data []byte) (*Document, error) {
+	p := &parser{data: data}
+	root, err := p.document()
+	if err != nil {
+		return nil, err
+	}
+	d := &Document{Root: root, data: data}
+	d.indent = d.detectIndent()
+	return d, nil
+}
+
+// Validate checks that data is a well-formed JSONC document without
+// duplicate object keys
+func Validate(data []byte) error {
+	p := &parser{data: data, strict: true}
+	_, err := p.document()
+	return err
+}
+
+// Bytes returns the text of the document
+func (d *Document) Bytes() []byte {
+	return d.data
+}
+
+// Position returns the 1-based line and column of the node in the document
+func (d *Document) Position(n *Node) (line int, column int) {
+	return position(d.data, n.start)
+}
+
+func position(data []byte, offset int) (int, int) {
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return line, column
+}
+
+// Get returns the value the JSON pointer (RFC 6901) refers to
+func (d *Document) Get(pointer string) (*Node, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	n := d.Root
+	for i, token := range tokens {
+		child := n.child(token)
+		if child == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, formatPointer(tokens[:i+1]))
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// child returns the member value or element of n named by a pointer token
+func (n *Node) child(token string) *Node {
+	switch n.Kind {
+	case Object:
+		if m := n.Member(token); m != nil {
+			return m.Value
+		}
+	case Array:
+		if i, ok := arrayIndex(token); ok && i < len(n.Elements) {
+			return n.Elements[i].Value
+		}
+	}
+	return nil
+}
+
+// parsePointer splits a JSON pointer into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer '%s': must start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/" + EscapePointer(token))
+	}
+	return b.String()
+}
+
+// EscapePointer escapes a key for use as a JSON pointer reference token
+func EscapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func arrayIndex(token string) (int, bool) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	return i, err == nil && i >= 0
+}
+
+// ToJSON converts a JSONC document to standard JSON by blanking out comments
+// and trailing commas. Offsets and line numbers are kept.
+func ToJSON(data []byte) ([]byte, error) {
+	p := &parser{data: data}
+	if _, err := p.document(); err != nil {
+		return nil, err
+	}
+	out := bytes.Clone(data)
+	for _, span := range p.blank {
+		for i := span[0]; i < span[1]; i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,308 @@
+package jsonc_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mazurov/devcontainer-template/pkg/jsonc"
+)
+
+const config = `// Development container
+{
+	// The image to use
+	"image": "debian:12", // pinned
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {}
+	},
+	"forwardPorts": [3000, 8080],
+}
+`
+
+func TestParse(t *testing.T) {
+	doc, err := jsonc.Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	image := doc.Root.Member("image")
+	if image == nil || image.Value.String() != "debian:12" {
+		t.Fatalf("image member = %+v", image)
+	}
+	if len(image.Comments) != 1 || image.Comments[0] != "// The image to use" {
+		t.Errorf("image comments = %q", image.Comments)
+	}
+	if image.LineComment != "// pinned" {
+		t.Errorf("image line comment = %q", image.LineComment)
+	}
+	if line, column := doc.Position(image.Value); line != 4 || column != 11 {
+		t.Errorf("Position(image) = %d:%d, want 4:11", line, column)
+	}
+
+	port, err := doc.Get("/forwardPorts/1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	var n int
+	if err := port.Decode(&n); err != nil || n != 8080 {
+		t.Errorf("Decode() = %d, %v", n, err)
+	}
+	if _, err := doc.Get("/features/missing"); !errors.Is(err, jsonc.ErrNotFound) {
+		t.Errorf("Get() of missing value error = %v, want ErrNotFound", err)
+	}
+
+	var decoded map[string]any
+	if err := doc.Root.Decode(&decoded); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(decoded) != 3 {
+		t.Errorf("decoded document = %v", decoded)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		edit func(doc *jsonc.Document) error
+		want string
+	}{
+		{
+			name: "replace value",
+			in:   config,
+			edit: func(doc *jsonc.Document) error { return doc.Set("/image", "debian:13") },
+			want: `// Development container
+{
+	// The image to use
+	"image": "debian:13", // pinned
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {}
+	},
+	"forwardPorts": [3000, 8080],
+}
+`,
+		},
+		{
+			name: "add member with trailing comma",
+			in:   config,
+			edit: func(doc *jsonc.Document) error {
+				return doc.Set("/customizations/vscode/extensions", []string{"golang.go"})
+			},
+			want: `// Development container
+{
+	// The image to use
+	"image": "debian:12", // pinned
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {}
+	},
+	"forwardPorts": [3000, 8080],
+	"customizations": {
+		"vscode": {
+			"extensions": [
+				"golang.go"
+			]
+		}
+	},
+}
+`,
+		},
+		{
+			name: "add member without trailing comma",
+			in:   "{\n  \"image\": \"debian:12\" // pinned\n}\n",
+			edit: func(doc *jsonc.Document) error { return doc.Set("/remoteUser", "vscode") },
+			want: "{\n  \"image\": \"debian:12\", // pinned\n  \"remoteUser\": \"vscode\"\n}\n",
+		},
+		{
+			name: "add member to empty object",
+			in:   config,
+			edit: func(doc *jsonc.Document) error {
+				return doc.Set("/features/ghcr.io~1devcontainers~1features~1go:1/version", "1.22")
+			},
+			want: `// Development container
+{
+	// The image to use
+	"image": "debian:12", // pinned
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {
+			"version": "1.22"
+		}
+	},
+	"forwardPorts": [3000, 8080],
+}
+`,
+		},
+		{
+			name: "add member before sibling",
+			in:   "{\n\t\"build\": {\n\t\t\"dockerfile\": \"Dockerfile\"\n\t}\n}",
+			edit: func(doc *jsonc.Document) error { return doc.SetBefore("/build/context", "..", "dockerfile") },
+			want: "{\n\t\"build\": {\n\t\t\"context\": \"..\",\n\t\t\"dockerfile\": \"Dockerfile\"\n\t}\n}",
+		},
+		{
+			name: "append element on one line",
+			in:   config,
+			edit: func(doc *jsonc.Document) error { return doc.Set("/forwardPorts/-", 9000) },
+			want: `// Development container
+{
+	// The image to use
+	"image": "debian:12", // pinned
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {}
+	},
+	"forwardPorts": [3000, 8080, 9000],
+}
+`,
+		},
+		{
+			name: "delete member with comments",
+			in:   config,
+			edit: func(doc *jsonc.Document) error { return doc.Delete("/image") },
+			want: `// Development container
+{
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {}
+	},
+	"forwardPorts": [3000, 8080],
+}
+`,
+		},
+		{
+			name: "delete last member",
+			in:   "{\n  \"a\": 1,\n  \"b\": 2\n}",
+			edit: func(doc *jsonc.Document) error { return doc.Delete("/b") },
+			want: "{\n  \"a\": 1\n}",
+		},
+		{
+			name: "delete only member",
+			in:   config,
+			edit: func(doc *jsonc.Document) error {
+				return doc.Delete("/features/ghcr.io~1devcontainers~1features~1go:1")
+			},
+			want: `// Development container
+{
+	// The image to use
+	"image": "debian:12", // pinned
+	"features": {},
+	"forwardPorts": [3000, 8080],
+}
+`,
+		},
+		{
+			name: "delete elements on one line",
+			in:   `{"ports": [1, 2, 3]}`,
+			edit: func(doc *jsonc.Document) error {
+				if err := doc.Delete("/ports/2"); err != nil {
+					return err
+				}
+				return doc.Delete("/ports/0")
+			},
+			want: `{"ports": [2]}`,
+		},
+		{
+			name: "set raw message",
+			in:   `{"a": 1}`,
+			edit: func(doc *jsonc.Document) error { return doc.Set("/b", json.RawMessage(`{"c":true}`)) },
+			want: `{"a": 1, "b": {"c":true}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := jsonc.Parse([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if err := tt.edit(doc); err != nil {
+				t.Fatalf("edit error = %v", err)
+			}
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("edited document =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		line   int
+		column int
+	}{
+		{name: "valid", in: config},
+		{name: "duplicate key", in: "{\n  \"image\": \"a\",\n  \"image\": \"b\"\n}", line: 3, column: 3},
+		{name: "missing comma", in: "{\n  \"a\": 1\n  \"b\": 2\n}", line: 3, column: 3},
+		{name: "unterminated comment", in: "{} /* comment", line: 1, column: 4},
+		{name: "trailing data", in: "{} {}", line: 1, column: 4},
+		{name: "single quotes", in: "{'a': 1}", line: 1, column: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := jsonc.Validate([]byte(tt.in))
+			if tt.line == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var syntaxErr *jsonc.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Validate() error = %v, want SyntaxError", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Errorf("error at %d:%d, want %d:%d: %v", syntaxErr.Line, syntaxErr.Column, tt.line, tt.column, err)
+			}
+		})
+	}
+
+	// Parse allows duplicate keys, the last one wins
+	doc, err := jsonc.Parse([]byte(`{"a": 1, "a": 2}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if a, _ := doc.Get("/a"); string(a.Raw()) != "2" {
+		t.Errorf("Get(/a) = %s, want 2", a.Raw())
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	in := "\xEF\xBB\xBF{\n\t\"image\": \"debian:12\"\n}\n"
+	if err := jsonc.Validate([]byte(in)); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	doc, err := jsonc.Parse([]byte(in))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if image, err := doc.Get("/image"); err != nil || image.String() != "debian:12" {
+		t.Fatalf("Get(/image) = %v, %v", image, err)
+	}
+	if err := doc.Set("/name", "dev"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	want := "\xEF\xBB\xBF{\n\t\"image\": \"debian:12\",\n\t\"name\": \"dev\"\n}\n"
+	if got := string(doc.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+
+	out, err := jsonc.ToJSON([]byte(in))
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v", err)
+	}
+	if !json.Valid(out) || len(out) != len(in) {
+		t.Errorf("ToJSON() = %q, want valid JSON with the same offsets", out)
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	out, err := jsonc.ToJSON([]byte(config))
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v", err)
+	}
+	if !json.Valid(out) {
+		t.Errorf("ToJSON() returned invalid JSON:\n%s", out)
+	}
+	if len(out) != len(config) {
+		t.Errorf("ToJSON() changed offsets")
+	}
+}
@@ -0,0 +1,310 @@
+package jsonc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// parser is a recursive descent parser for JSONC
+type parser struct {
+	data []byte
+	pos  int
+	// strict rejects duplicate object keys
+	strict bool
+	// blank holds the spans of comments and trailing commas
+	blank [][2]int
+}
+
+// comment is a comment found between tokens
+type comment struct {
+	text       string
+	start, end int
+}
+
+func (p *parser) errorf(pos int, format string, args ...any) error {
+	line, column := position(p.data, pos)
+	return &SyntaxError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// bom is the UTF-8 byte order mark some editors write at the start of a file
+var bom = []byte("\xEF\xBB\xBF")
+
+func (p *parser) document() (*Node, error) {
+	// A leading byte order mark is skipped, and kept in the document text
+	if bytes.HasPrefix(p.data, bom) {
+		p.pos = len(bom)
+		p.blank = append(p.blank, [2]int{0, len(bom)})
+	}
+	if _, err := p.space(); err != nil {
+		return nil, err
+	}
+	n, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.space(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.data) {
+		return nil, p.errorf(p.pos, "unexpected %q after top-level value", p.data[p.pos])
+	}
+	return n, nil
+}
+
+// space skips whitespace and comments, returning the comments
+func (p *parser) space() ([]comment, error) {
+	var comments []comment
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case c == '/' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '/':
+			start := p.pos
+			end := bytes.IndexByte(p.data[start:], '\n')
+			if end < 0 {
+				end = len(p.data)
+			} else {
+				end += start
+			}
+			p.pos = end
+			comments = append(comments, p.comment(start, end))
+		case c == '/' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '*':
+			start := p.pos
+			end := bytes.Index(p.data[start+2:], []byte("*/"))
+			if end < 0 {
+				return nil, p.errorf(start, "unterminated block comment")
+			}
+			p.pos = start + 2 + end + 2
+			comments = append(comments, p.comment(start, p.pos))
+		default:
+			return comments, nil
+		}
+	}
+	return comments, nil
+}
+
+func (p *parser) comment(start, end int) comment {
+	p.blank = append(p.blank, [2]int{start, end})
+	return comment{text: string(bytes.TrimRight(p.data[start:end], "\r")), start: start, end: end}
+}
+
+func (p *parser) value() (*Node, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf(p.pos, "unexpected end of input, expected a value")
+	}
+	start := p.pos
+	var n *Node
+	var err error
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		n, err = p.object()
+	case c == '[':
+		n, err = p.array()
+	case c == '"':
+		_, err = p.string()
+		n = &Node{Kind: String}
+	case c == '-' || (c >= '0' && c <= '9'):
+		n, err = p.number()
+	case c >= 'a' && c <= 'z':
+		n, err = p.literal()
+	default:
+		return nil, p.errorf(p.pos, "unexpected %q, expected a value", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.start = start
+	n.raw = p.data[start:p.pos]
+	return n, nil
+}
+
+func (p *parser) string() (string, error) {
+	start := p.pos
+	for i := start + 1; i < len(p.data); i++ {
+		switch p.data[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", p.errorf(i, "unexpected newline in string")
+		case '"':
+			p.pos = i + 1
+			var s string
+			if err := json.Unmarshal(p.data[start:p.pos], &s); err != nil {
+				return "", p.errorf(start, "invalid string: %v", err)
+			}
+			return s, nil
+		}
+	}
+	return "", p.errorf(start, "unterminated string")
+}
+
+func (p *parser) number() (*Node, error) {
+	start := p.pos
+	for p.pos < len(p.data) && bytes.IndexByte([]byte("+-.0123456789eE"), p.data[p.pos]) >= 0 {
+		p.pos++
+	}
+	if !json.Valid(p.data[start:p.pos]) {
+		return nil, p.errorf(start, "invalid number %q", p.data[start:p.pos])
+	}
+	return &Node{Kind: Number}, nil
+}
+
+func (p *parser) literal() (*Node, error) {
+	start := p.pos
+	for p.pos < len(p.data) && p.data[p.pos] >= 'a' && p.data[p.pos] <= 'z' {
+		p.pos++
+	}
+	switch word := string(p.data[start:p.pos]); word {
+	case "true", "false":
+		return &Node{Kind: Bool}, nil
+	case "null":
+		return &Node{Kind: Null}, nil
+	default:
+		return nil, p.errorf(start, "unexpected literal '%s'", word)
+	}
+}
+
+// attach splits comments into the line comment of the previous item, if it
+// ends on the same line, and the leading comments of the next one
+func (p *parser) attach(prev *item, comments []comment) (string, []comment) {
+	if prev == nil || len(comments) == 0 || bytes.IndexByte(p.data[prev.end:comments[0].start], '\n') >= 0 {
+		return "", comments
+	}
+	prev.end = comments[0].end
+	return comments[0].text, comments[1:]
+}
+
+// separator parses the comma after an item, if any. Comments before a
+// missing comma are left for the next item.
+func (p *parser) separator(it *item) error {
+	it.valueEnd, it.end, it.comma = p.pos, p.pos, -1
+	save, blank := p.pos, len(p.blank)
+	if _, err := p.space(); err != nil {
+		return err
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == ',' {
+		it.comma = p.pos
+		p.pos++
+		it.end = p.pos
+		return nil
+	}
+	p.pos, p.blank = save, p.blank[:blank]
+	return nil
+}
+
+func texts(comments []comment) []string {
+	var s []string
+	for _, c := range comments {
+		s = append(s, c.text)
+	}
+	return s
+}
+
+func (p *parser) object() (*Node, error) {
+	n := &Node{Kind: Object}
+	open := p.pos
+	p.pos++
+	seen := make(map[string]bool)
+	var prev *Member
+	for {
+		comments, err := p.space()
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil {
+			prev.LineComment, comments = p.attach(&prev.item, comments)
+		}
+		if p.pos >= len(p.data) {
+			return nil, p.errorf(open, "unterminated object")
+		}
+		if p.data[p.pos] == '}' {
+			if prev != nil && prev.comma >= 0 {
+				p.blank = append(p.blank, [2]int{prev.comma, prev.comma + 1})
+			}
+			p.pos++
+			return n, nil
+		}
+		if prev != nil && prev.comma < 0 {
+			return nil, p.errorf(p.pos, "expected ',' or '}' after object member")
+		}
+		if p.data[p.pos] != '"' {
+			return nil, p.errorf(p.pos, "unexpected %q, expected an object key", p.data[p.pos])
+		}
+
+		m := &Member{Comments: texts(comments)}
+		m.start = p.pos
+		if len(comments) > 0 {
+			m.start = comments[0].start
+		}
+		keyPos := p.pos
+		if m.Key, err = p.string(); err != nil {
+			return nil, err
+		}
+		if p.strict && seen[m.Key] {
+			return nil, p.errorf(keyPos, "duplicate key '%s'", m.Key)
+		}
+		seen[m.Key] = true
+		if _, err := p.space(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return nil, p.errorf(p.pos, "expected ':' after object key")
+		}
+		p.pos++
+		if _, err := p.space(); err != nil {
+			return nil, err
+		}
+		if m.Value, err = p.value(); err != nil {
+			return nil, err
+		}
+		if err := p.separator(&m.item); err != nil {
+			return nil, err
+		}
+		n.Members = append(n.Members, m)
+		prev = m
+	}
+}
+
+func (p *parser) array() (*Node, error) {
+	n := &Node{Kind: Array}
+	open := p.pos
+	p.pos++
+	var prev *Element
+	for {
+		comments, err := p.space()
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil {
+			prev.LineComment, comments = p.attach(&prev.item, comments)
+		}
+		if p.pos >= len(p.data) {
+			return nil, p.errorf(open, "unterminated array")
+		}
+		if p.data[p.pos] == ']' {
+			if prev != nil && prev.comma >= 0 {
+				p.blank = append(p.blank, [2]int{prev.comma, prev.comma + 1})
+			}
+			p.pos++
+			return n, nil
+		}
+		if prev != nil && prev.comma < 0 {
+			return nil, p.errorf(p.pos, "expected ',' or ']' after array element")
+		}
+
+		e := &Element{Comments: texts(comments)}
+		e.start = p.pos
+		if len(comments) > 0 {
+			e.start = comments[0].start
+		}
+		if e.Value, err = p.value(); err != nil {
+			return nil, err
+		}
+		if err := p.separator(&e.item); err != nil {
+			return nil, err
+		}
+		n.Elements = append(n.Elements, e)
+		prev = e
+	}
+}